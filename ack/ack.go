@@ -0,0 +1,288 @@
+// Package ack implements acknowledged delivery over stream connections. The sender prefixes every
+// message with a sequence number; the receiver periodically returns the highest sequence number of
+// the messages that it has handled. The sender keeps unacknowledged messages, so that they can be
+// sent again over a new connection. Messages may therefore arrive more than once, but aren't lost.
+package ack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	Window   = 1024             // max # of unacknowledged messages before a Writer waits
+	Timeout  = 10 * time.Second // max wait for an acknowledgement when the window is full
+	Interval = time.Second / 10 // an Acker acknowledges at least this often, when there's something to ack
+	Every    = 100              // ... and after this many messages
+)
+
+// ErrTimeout is returned by a Writer when its window is full, and the receiver doesn't acknowledge.
+var ErrTimeout = errors.New("no acknowledgement received")
+
+// Frame prefixes a message with its sequence number.
+func Frame(seq uint64, buf []byte) []byte {
+	return append([]byte(strconv.FormatUint(seq, 10)+" "), buf...)
+}
+
+// Unframe splits a framed message into the sequence number and the message. When the message isn't
+// framed, false is returned.
+func Unframe(buf []byte) (uint64, []byte, bool) {
+	i := bytes.IndexByte(buf, ' ')
+	if i < 1 {
+		return 0, buf, false
+	}
+	seq, err := strconv.ParseUint(string(buf[:i]), 10, 64)
+	if err != nil {
+		return 0, buf, false
+	}
+	return seq, buf[i+1:], true
+}
+
+type pending struct {
+	seq uint64
+	buf []byte
+}
+
+// notification is a call of Notify, waiting for the acknowledgement of message seq.
+type notification struct {
+	seq uint64
+	f   func(error)
+}
+
+// Writer sends framed messages over a connection and keeps them until they are acknowledged.
+// Every call of Write must hold exactly one message.
+type Writer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	conn    io.ReadWriter
+	gen     int // incremented upon Attach, so that acks of an old connection are ignored
+	seq     uint64
+	unacked []pending
+	notify  []notification
+}
+
+func NewWriter() *Writer {
+	w := &Writer{}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// Attach makes w send over conn. Messages that weren't acknowledged over a previous connection are
+// sent again.
+func (w *Writer) Attach(conn io.ReadWriter) error {
+	w.mu.Lock()
+	w.conn = conn
+	w.gen++
+	gen := w.gen
+	resend := append([]pending(nil), w.unacked...)
+	w.mu.Unlock()
+
+	go w.readAcks(conn, gen)
+	for _, p := range resend {
+		if err := writeAll(conn, Frame(p.seq, p.buf)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write sends buf as one message. It waits while the window of unacknowledged messages is full. When
+// sending fails, buf isn't kept; it's up to the caller to send it again.
+func (w *Writer) Write(buf []byte) (int, error) {
+	w.mu.Lock()
+	if err := w.waitFor(func() bool { return len(w.unacked) < Window }); err != nil {
+		w.mu.Unlock()
+		return 0, err
+	}
+	w.seq++
+	p := pending{
+		seq: w.seq,
+		buf: append([]byte(nil), buf...),
+	}
+	w.unacked = append(w.unacked, p)
+	conn := w.conn
+	w.mu.Unlock()
+
+	if err := writeAll(conn, Frame(p.seq, p.buf)); err != nil {
+		w.mu.Lock()
+		if n := len(w.unacked); n > 0 && w.unacked[n-1].seq == p.seq {
+			w.unacked = w.unacked[:n-1]
+		}
+		w.mu.Unlock()
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Notify calls f once the messages that were written so far are acknowledged, which may be at
+// once. Notifications that are still waiting when the messages are detached, are handled by
+// Settle. f is called while w is locked, so it may not use w.
+func (w *Writer) Notify(f func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.notify = append(w.notify, notification{seq: w.seq, f: f})
+	w.notifyAcked()
+}
+
+// Settle calls the waiting notifications with err, e.g. after the unacknowledged messages were
+// detached and spooled (nil), or can't be delivered (an error).
+func (w *Writer) Settle(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, n := range w.notify {
+		n.f(err)
+	}
+	w.notify = nil
+}
+
+// notifyAcked calls the notifications whose messages are acknowledged, oldest first. The caller
+// holds w.mu.
+func (w *Writer) notifyAcked() {
+	for len(w.notify) > 0 && (len(w.unacked) == 0 || w.unacked[0].seq > w.notify[0].seq) {
+		w.notify[0].f(nil)
+		w.notify = w.notify[1:]
+	}
+}
+
+// Wait waits until all messages are acknowledged, or until Timeout.
+func (w *Writer) Wait() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.waitFor(func() bool { return len(w.unacked) == 0 })
+}
+
+// Detach returns the unacknowledged messages and forgets them, e.g. to spool them elsewhere.
+func (w *Writer) Detach() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := [][]byte{}
+	for _, p := range w.unacked {
+		out = append(out, p.buf)
+	}
+	w.unacked = nil
+	w.gen++
+	return out
+}
+
+// Unacked returns the number of unacknowledged messages.
+func (w *Writer) Unacked() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.unacked)
+}
+
+// waitFor waits until cond is true, or until Timeout. The caller holds w.mu.
+func (w *Writer) waitFor(cond func() bool) error {
+	deadline := time.Now().Add(Timeout)
+	timer := time.AfterFunc(Timeout, w.cond.Broadcast)
+	defer timer.Stop()
+	for !cond() {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w within %v, %v messages outstanding", ErrTimeout, Timeout, len(w.unacked))
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// readAcks handles the acknowledgements that arrive over conn, until it's closed.
+func (w *Writer) readAcks(conn io.Reader, gen int) {
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		seq, err := strconv.ParseUint(sc.Text(), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.mu.Lock()
+		if gen != w.gen {
+			w.mu.Unlock()
+			return
+		}
+		i := 0
+		for i < len(w.unacked) && w.unacked[i].seq <= seq {
+			i++
+		}
+		w.unacked = w.unacked[i:]
+		w.notifyAcked()
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// Acker acknowledges handled messages to the sender. Messages must be reported as handled in the
+// order in which they were received.
+type Acker struct {
+	conn io.Writer
+	ch   chan uint64
+	done chan struct{}
+}
+
+func NewAcker(conn io.Writer) *Acker {
+	a := &Acker{
+		conn: conn,
+		ch:   make(chan uint64, Window),
+		done: make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Handled reports that the message with sequence number seq is handled.
+func (a *Acker) Handled(seq uint64) {
+	a.ch <- seq
+}
+
+// Stop sends the last acknowledgement. Handled may not be called afterwards.
+func (a *Acker) Stop() {
+	close(a.ch)
+	<-a.done
+}
+
+func (a *Acker) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+
+	var last, sent uint64
+	send := func() {
+		if last != sent {
+			writeAll(a.conn, []byte(strconv.FormatUint(last, 10)+"\n"))
+			sent = last
+		}
+	}
+	count := 0
+	for {
+		select {
+		case seq, ok := <-a.ch:
+			if !ok {
+				send()
+				return
+			}
+			last = seq
+			if count++; count >= Every {
+				send()
+				count = 0
+			}
+		case <-ticker.C:
+			send()
+			count = 0
+		}
+	}
+}
+
+func writeAll(w io.Writer, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := w.Write(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package ack
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	for _, test := range []struct {
+		buf      string
+		wantSeq  uint64
+		wantBuf  string
+		wantOkay bool
+	}{
+		{buf: string(Frame(42, []byte("2022-01-01 | I | hi\n"))), wantSeq: 42, wantBuf: "2022-01-01 | I | hi\n", wantOkay: true},
+		{buf: "2022-01-01 | I | hi\n", wantBuf: "2022-01-01 | I | hi\n"},
+		{buf: " 42 x", wantBuf: " 42 x"},
+		{buf: "42", wantBuf: "42"},
+	} {
+		seq, buf, ok := Unframe([]byte(test.buf))
+		if seq != test.wantSeq || string(buf) != test.wantBuf || ok != test.wantOkay {
+			t.Errorf("Unframe(%q) = %v,%q,%v, want %v,%q,%v",
+				test.buf, seq, buf, ok, test.wantSeq, test.wantBuf, test.wantOkay)
+		}
+	}
+}
+
+// receive reads framed messages from conn and sends them to ch.
+func receive(conn net.Conn, ch chan string) {
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		ch <- sc.Text()
+	}
+	close(ch)
+}
+
+func TestWindow(t *testing.T) {
+	defer func(w int, to time.Duration) { Window, Timeout = w, to }(Window, Timeout)
+	Window, Timeout = 2, time.Second/10
+
+	client, server := net.Pipe()
+	defer client.Close()
+	w := NewWriter()
+	if err := w.Attach(client); err != nil {
+		t.Fatalf("Attach(_) = %v, need nil error", err)
+	}
+	go receive(server, make(chan string, 10)) // never acknowledges
+
+	for _, m := range []string{"one\n", "two\n"} {
+		if _, err := w.Write([]byte(m)); err != nil {
+			t.Fatalf("Write(%q) = _,%v, need nil error", m, err)
+		}
+	}
+	if _, err := w.Write([]byte("three\n")); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Write(_) with a full window = _,%v, want ErrTimeout", err)
+	}
+	if got := w.Unacked(); got != 2 {
+		t.Errorf("Unacked() = %v, want 2", got)
+	}
+	if got := len(w.Detach()); got != 2 {
+		t.Errorf("Detach() returns %v messages, want 2", got)
+	}
+	if got := w.Unacked(); got != 0 {
+		t.Errorf("Unacked() after Detach() = %v, want 0", got)
+	}
+}
+
+func TestResendAndAck(t *testing.T) {
+	w := NewWriter()
+
+	// First connection: the receiver gets the messages, but crashes before acknowledging.
+	client1, server1 := net.Pipe()
+	if err := w.Attach(client1); err != nil {
+		t.Fatalf("Attach(_) = %v, need nil error", err)
+	}
+	ch1 := make(chan string, 10)
+	go receive(server1, ch1)
+	for _, m := range []string{"one\n", "two\n"} {
+		if _, err := w.Write([]byte(m)); err != nil {
+			t.Fatalf("Write(%q) = _,%v, need nil error", m, err)
+		}
+	}
+	<-ch1
+	<-ch1
+	server1.Close()
+	client1.Close()
+
+	// Second connection: the messages are sent again, and acknowledged.
+	client2, server2 := net.Pipe()
+	defer client2.Close()
+	ch2 := make(chan string, 10)
+	go receive(server2, ch2)
+	done := make(chan error)
+	go func() { done <- w.Attach(client2) }()
+
+	acker := NewAcker(server2)
+	for _, want := range []string{"1 one", "2 two"} {
+		got := <-ch2
+		if got != want {
+			t.Errorf("after reconnecting received %q, want %q", got, want)
+		}
+		seq, _, _ := Unframe([]byte(got))
+		acker.Handled(seq)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Attach(_) = %v, need nil error", err)
+	}
+	acker.Stop()
+	if err := w.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil error", err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	w := NewWriter()
+	if err := w.Attach(client); err != nil {
+		t.Fatalf("Attach(_) = %v, need nil error", err)
+	}
+	ch := make(chan string, 10)
+	go receive(server, ch)
+
+	notified := make(chan string, 10)
+	notify := func(name string) func(error) {
+		return func(err error) { notified <- fmt.Sprintf("%v:%v", name, err) }
+	}
+	w.Notify(notify("nothing written")) // at once
+	for _, m := range []string{"one\n", "two\n"} {
+		if _, err := w.Write([]byte(m)); err != nil {
+			t.Fatalf("Write(%q) = _,%v, need nil error", m, err)
+		}
+		w.Notify(notify(strings.TrimSpace(m)))
+		<-ch
+	}
+
+	// Acknowledging "one" notifies for it, but not for "two".
+	acker := NewAcker(server)
+	acker.Handled(1)
+	acker.Stop()
+	for _, want := range []string{"nothing written:<nil>", "one:<nil>"} {
+		select {
+		case got := <-notified:
+			if got != want {
+				t.Errorf("notified %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no notification, want %q", want)
+		}
+	}
+	w.Settle(errors.New("lost"))
+	if got := <-notified; got != "two:lost" {
+		t.Errorf("Settle(_) notified %q, want %q", got, "two:lost")
+	}
+	if len(notified) > 0 {
+		t.Errorf("unexpected notification %q", <-notified)
+	}
+}
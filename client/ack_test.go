@@ -0,0 +1,165 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/ack"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// ackReceiver accepts connections on addr and sends the received messages to ch. When acking is
+// true, the messages are acknowledged. The returned function stops it, like a crashing server.
+func ackReceiver(t *testing.T, addr string, acking bool, ch chan string) func() {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("net.Listen(_,%v) = _,%v, need nil error", addr, err)
+	}
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				var acker *ack.Acker
+				if acking {
+					acker = ack.NewAcker(conn)
+					defer acker.Stop()
+				}
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					seq, buf, _ := ack.Unframe(sc.Bytes())
+					parts := strings.Split(string(buf), " | ")
+					ch <- parts[len(parts)-1]
+					if acker != nil {
+						acker.Handled(seq)
+					}
+				}
+			}()
+		}
+	}()
+	return func() {
+		l.Close()
+		for {
+			select {
+			case conn := <-conns:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	}
+}
+
+func TestAckResend(t *testing.T) {
+	defer func(w time.Duration) { RestartWait = w }(RestartWait)
+	RestartWait = time.Second / 100
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// The first server receives, but crashes before acknowledging.
+	ch1 := make(chan string, 100)
+	stop := ackReceiver(t, addr, false, ch1)
+	ur, err := uri.New("tcp://" + addr + "?ack=true")
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	cl := &Client{URI: ur}
+	if err := cl.ApplyParams(); err != nil {
+		t.Fatalf("ApplyParams() = %v, need nil error", err)
+	}
+	if err := cl.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, need nil error", err)
+	}
+	cl.Info("one")
+	cl.Info("two")
+	<-ch1
+	<-ch1
+	stop()
+
+	// The next server acknowledges. Nothing is lost in between.
+	ch2 := make(chan string, 100)
+	defer ackReceiver(t, addr, true, ch2)()
+	want := []string{"one", "two"}
+	for i := 0; i < 5; i++ {
+		m := fmt.Sprintf("m%v", i)
+		if err := cl.Info(m); err != nil {
+			t.Fatalf("Info(_) = %v, need nil error", err)
+		}
+		want = append(want, m)
+	}
+	if err := cl.Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	got := map[string]bool{}
+	for len(ch2) > 0 {
+		got[<-ch2] = true
+	}
+	for _, m := range want {
+		if !got[m] {
+			t.Errorf("message %q was lost, the second server received %v", m, got)
+		}
+	}
+}
+
+func TestDeliverAck(t *testing.T) {
+	defer func(to time.Duration) { ack.Timeout = to }(ack.Timeout)
+	ack.Timeout = time.Second / 10
+
+	for _, acking := range []bool{true, false} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+
+		ch := make(chan string, 10)
+		stop := ackReceiver(t, addr, acking, ch)
+		ur, err := uri.New("tcp://" + addr + "?ack=true")
+		if err != nil {
+			t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+		}
+		cl := &Client{URI: ur}
+		if err := cl.ApplyParams(); err != nil {
+			t.Fatalf("ApplyParams() = %v, need nil error", err)
+		}
+		if err := cl.Connect(); err != nil {
+			t.Fatalf("Connect() = %v, need nil error", err)
+		}
+		delivered := make(chan error, 1)
+		cl.Deliver([]byte("2022-01-01 | I | hello\n"), func(err error) { delivered <- err })
+		<-ch
+
+		// Only the acknowledgement reports delivery. Without it, Close() reports the loss.
+		select {
+		case err := <-delivered:
+			if !acking || err != nil {
+				t.Errorf("acking=%v: Deliver(_) reported %v before Close()", acking, err)
+			}
+		case <-time.After(time.Second / 2):
+			if acking {
+				t.Errorf("acking=%v: Deliver(_) reported nothing", acking)
+			}
+		}
+		cl.Close()
+		if !acking {
+			if err := <-delivered; err == nil {
+				t.Errorf("acking=%v: Deliver(_) reported nil after Close(), want error", acking)
+			}
+		}
+		stop()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/KarelKubat/smartlog/client/http"
 	"github.com/KarelKubat/smartlog/client/network"
 	"github.com/KarelKubat/smartlog/client/none"
+	"github.com/KarelKubat/smartlog/client/syslog"
 	"github.com/KarelKubat/smartlog/uri"
 )
 
@@ -24,8 +25,16 @@ func New(u string) (*client.Client, error) {
 		return network.New(ur)
 	case uri.UDP:
 		return network.New(ur)
+	case uri.Unix:
+		return network.New(ur)
+	case uri.Unixgram:
+		return network.New(ur)
+	case uri.TLS:
+		return network.New(ur)
 	case uri.HTTP:
 		return http.New(ur)
+	case uri.Syslog, uri.SyslogTCP, uri.SyslogUnix:
+		return syslog.New(ur)
 	}
 	return nil, errors.New("internal foobar, unhandled case in any.New")
 }
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// queued is a message in the queue of an async client, or a request to report when the messages
+// before it are written.
+type queued struct {
+	lev       msg.MsgType
+	buf       []byte
+	delivered func(error) // only in messages from Deliver()
+	flushed   chan error  // only in flush requests
+}
+
+// StartAsync makes the client return from Info() etc. without waiting for the write. Up to size
+// messages are queued and written by a background goroutine. When the queue fills up, Debug and
+// then Info messages are dropped, just like in a server; more important messages block until there
+// is room. Flush() waits for the queue to drain, Close() drains it and stops the goroutine.
+// StopAsync() does the same without closing the client, later messages are written synchronously.
+func (c *Client) StartAsync(size int) error {
+	t := c.transport()
+	t.qmu.Lock()
+	defer t.qmu.Unlock()
+	if t.queue != nil {
+		return fmt.Errorf("%v: already asynchronous", t)
+	}
+	t.queue = make(chan queued, size)
+	t.drained = make(chan struct{})
+	go t.drain(t.queue, t.drained)
+	return nil
+}
+
+// Flush waits until all queued messages are written and returns the first write error since the
+// previous Flush. Synchronous clients have nothing to flush, their messages are written at once.
+func (c *Client) Flush() error {
+	t := c.transport()
+	t.qmu.RLock()
+	if t.queue == nil {
+		t.qmu.RUnlock()
+		return nil
+	}
+	flushed := make(chan error)
+	t.queue <- queued{flushed: flushed}
+	t.qmu.RUnlock()
+	return <-flushed
+}
+
+// StopAsync drains the queue of an async client and stops its goroutine. Messages that are sent
+// afterwards are written synchronously.
+func (c *Client) StopAsync() error {
+	c = c.transport()
+	err := c.Flush()
+
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	if c.queue != nil {
+		close(c.queue)
+		<-c.drained
+		c.queue = nil
+	}
+	return err
+}
+
+// async is true when messages are queued, see StartAsync.
+func (c *Client) async() bool {
+	c.qmu.RLock()
+	defer c.qmu.RUnlock()
+	return c.queue != nil
+}
+
+// enqueue queues buf when the client is asynchronous, and returns false when it isn't.
+func (c *Client) enqueue(lev msg.MsgType, buf []byte) bool {
+	c.qmu.RLock()
+	defer c.qmu.RUnlock()
+	if c.queue == nil {
+		return false
+	}
+	if used := len(c.queue); msg.Droppable(lev, used, cap(c.queue)) {
+		if atomic.CompareAndSwapInt32(&c.dropping, 0, 1) {
+			c.warn("%v: dropping trace/debug/info message(s), %v already queued, limit %v", c, used, cap(c.queue))
+		}
+		return true
+	}
+	atomic.StoreInt32(&c.dropping, 0)
+	c.queue <- queued{lev: lev, buf: buf}
+	return true
+}
+
+// enqueueDelivery is enqueue for Deliver(): buf is never dropped, and f is called once it's
+// delivered.
+func (c *Client) enqueueDelivery(buf []byte, f func(error)) bool {
+	c.qmu.RLock()
+	defer c.qmu.RUnlock()
+	if c.queue == nil {
+		return false
+	}
+	c.queue <- queued{lev: msg.TypeFromBytes(buf), buf: buf, delivered: f}
+	return true
+}
+
+// drain writes queued messages until the queue is closed.
+func (c *Client) drain(queue chan queued, drained chan struct{}) {
+	var firstErr error
+	for q := range queue {
+		if q.flushed != nil {
+			q.flushed <- firstErr
+			firstErr = nil
+			continue
+		}
+		err := c.write(q.buf)
+		if q.delivered != nil {
+			if err != nil {
+				q.delivered(err)
+			} else {
+				c.delivered(q.delivered)
+			}
+		}
+		if err == nil {
+			err = c.reopenIfGone()
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			c.warn("%v: asynchronous write failed: %v", c, err)
+		}
+	}
+	close(drained)
+}
+
+// warn reports a problem of the client itself. The default client can't report to itself, that
+// might deadlock, so it reports to stderr. That includes the client that the default client was
+// derived from, e.g. using With() or Named(), since they share the transport.
+func (c *Client) warn(format string, args ...interface{}) {
+	if c == DefaultClient.transport() {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		return
+	}
+	Warnf(format, args...)
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// gatedWriter signals when a write starts, and blocks it until the gate opens.
+type gatedWriter struct {
+	buf     bytes.Buffer
+	entered chan bool
+	gate    chan bool
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.entered <- true
+	<-g.gate
+	return g.buf.Write(p)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk on fire")
+}
+
+func newTestClient(w io.Writer) *Client {
+	return &Client{
+		Writer: w,
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"test"},
+		},
+	}
+}
+
+func TestAsync(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := newTestClient(buf)
+	if err := cl.StartAsync(100); err != nil {
+		t.Fatalf("StartAsync(_) = %v, need nil error", err)
+	}
+	if err := cl.StartAsync(100); err == nil {
+		t.Errorf("second StartAsync(_) = nil, want error")
+	}
+	derived := cl.With()
+	for i := 0; i < 10; i++ {
+		if err := derived.Infof("message %v", i); err != nil {
+			t.Fatalf("Infof(_) = %v, need nil error", err)
+		}
+	}
+	if err := derived.Flush(); err != nil {
+		t.Fatalf("Flush() = %v, need nil error", err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 10 {
+		t.Errorf("after Flush() got %v lines, want 10", got)
+	}
+
+	// After StopAsync(), writes are synchronous again.
+	if err := cl.StopAsync(); err != nil {
+		t.Fatalf("StopAsync() = %v, need nil error", err)
+	}
+	if cl.async() {
+		t.Errorf("async() = true after StopAsync(), want false")
+	}
+	if err := cl.Info("sync"); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 11 {
+		t.Errorf("after StopAsync() and Info() got %v lines, want 11", got)
+	}
+}
+
+func TestAsyncDrops(t *testing.T) {
+	w := &gatedWriter{
+		entered: make(chan bool),
+		gate:    make(chan bool),
+	}
+	cl := newTestClient(w)
+	cl.StartAsync(4)
+	defer cl.Close()
+
+	// The first message is taken from the queue and blocks in the writer.
+	cl.Info("first")
+	<-w.entered
+
+	// The queue has 4 slots. Debug messages are dropped when more than 2 are taken,
+	// Info messages when more than 3 are taken, warnings never.
+	cl.Warn("w1")     // 1 taken
+	cl.Warn("w2")     // 2 taken
+	cl.Debug(0, "d1") // 3 taken
+	cl.Debug(0, "d2") // dropped
+	cl.Info("i1")     // 4 taken
+	cl.Info("i2")     // dropped
+	go func() {
+		for range w.entered {
+			w.gate <- true
+		}
+	}()
+	w.gate <- true
+	if err := cl.Flush(); err != nil {
+		t.Fatalf("Flush() = %v, need nil error", err)
+	}
+	close(w.entered)
+
+	got := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(w.buf.String()), "\n") {
+		parts := strings.Split(line, " | ")
+		got = append(got, parts[len(parts)-1])
+	}
+	if want := "first w1 w2 d1 i1"; strings.Join(got, " ") != want {
+		t.Errorf("written messages: %v, want %v", got, want)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	// Synchronous clients report at once.
+	buf := new(bytes.Buffer)
+	var got []error
+	report := func(err error) { got = append(got, err) }
+	newTestClient(buf).Deliver([]byte("2022-01-01 | D | one\n"), report)
+	newTestClient(failingWriter{}).Deliver([]byte("2022-01-01 | D | two\n"), report)
+	if len(got) != 2 || got[0] != nil || got[1] == nil || buf.String() != "2022-01-01 | D | one\n" {
+		t.Errorf("Deliver(_) on synchronous clients reported %v and wrote %q, want nil, an error and the message", got, buf.String())
+	}
+
+	// Async clients report after writing, and don't drop when the queue is full.
+	w := &gatedWriter{
+		entered: make(chan bool),
+		gate:    make(chan bool),
+	}
+	cl := newTestClient(w)
+	cl.StartAsync(2)
+	defer cl.Close()
+	delivered := make(chan string, 10)
+	go func() {
+		for _, m := range []string{"d1", "d2", "d3", "d4"} {
+			m := m
+			cl.Deliver([]byte("2022-01-01 | D | "+m+"\n"), func(err error) {
+				delivered <- fmt.Sprintf("%v:%v", m, err)
+			})
+		}
+	}()
+	<-w.entered // d1 blocks in the writer, d4 waits for room in the queue
+	if len(delivered) > 0 {
+		t.Errorf("Deliver(_) on an async client reported %q before writing", <-delivered)
+	}
+	go func() {
+		for range w.entered {
+			w.gate <- true
+		}
+	}()
+	w.gate <- true
+	for _, want := range []string{"d1:<nil>", "d2:<nil>", "d3:<nil>", "d4:<nil>"} {
+		if got := <-delivered; got != want {
+			t.Errorf("Deliver(_) on an async client reported %q, want %q", got, want)
+		}
+	}
+	close(w.entered)
+}
+
+func TestAsyncErrors(t *testing.T) {
+	cl := newTestClient(failingWriter{})
+	cl.StartAsync(10)
+	defer cl.Close()
+
+	if err := cl.Warn("lost"); err != nil {
+		t.Errorf("Warn(_) = %v, want nil error, the write happens later", err)
+	}
+	if err := cl.Flush(); err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Errorf("Flush() = %v, want error with %q", err, "disk on fire")
+	}
+	if err := cl.Flush(); err != nil {
+		t.Errorf("second Flush() = %v, want nil error, the error was already reported", err)
+	}
+}
+
+// brokenPipeWriter fails every write as if the peer went away.
+type brokenPipeWriter struct{}
+
+func (brokenPipeWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write: broken pipe")
+}
+
+func TestWarnDerivedDefaultClient(t *testing.T) {
+	defer func(a int, w time.Duration) { RestartAttempts, RestartWait = a, w }(RestartAttempts, RestartWait)
+	RestartAttempts = 1
+	RestartWait = 0
+
+	cl := &Client{
+		Writer: brokenPipeWriter{},
+		URI: &uri.URI{
+			Scheme: uri.TCP,
+			Parts:  []string{"non-existent-hostname", "12345"},
+		},
+	}
+	saved := DefaultClient
+	defer func() { DefaultClient = saved }()
+	DefaultClient = cl.Named("app")
+
+	// The warning about the write failure must not go to the client that is writing.
+	done := make(chan error)
+	go func() { done <- DefaultClient.Info("hello") }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "failed to (re)connect") {
+			t.Errorf("Info() = %v, want error with %q", err, "failed to (re)connect")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Info() on a derived default client deadlocks when the write fails")
+	}
+}
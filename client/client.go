@@ -1,13 +1,19 @@
 package client
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/KarelKubat/smartlog/ack"
 	"github.com/KarelKubat/smartlog/msg"
 	"github.com/KarelKubat/smartlog/uri"
 )
@@ -19,140 +25,429 @@ var (
 
 type Client struct {
 	// May be set by client code
-	TimeFormat     string // defaults to YYYY-MM-DD HH:MM:SS localtime
-	DebugThreshold uint8  // defaults to 0
+	TimeFormat     string      // defaults to YYYY-MM-DD HH:MM:SS localtime
+	DebugThreshold uint8       // defaults to 0, not used by named clients (see Named)
+	Format         msg.Format  // defaults to msg.Text
+	Rotation       *Rotation   // only in file loggers, nil = never rotate
+	TLSConfig      *tls.Config // only in tls loggers, set from the URI parameters
+	Spool          *Spool      // only in network loggers, nil = messages are lost while disconnected
+	Ack            bool        // only in tcp, unix and tls loggers: the server acknowledges messages
+	Caller         bool        // when true, messages state where they were emitted (file:line, function)
+	Origin         *msg.Origin // when not nil, messages state who emitted them (host, PID etc.)
 
 	// Set by implementations
-	Writer     io.Writer // writer for Info(f), Warn(f), Error(f)
-	URI        *uri.URI  // URI from which the client was constructed
-	Conn       net.Conn  // Only in network loggers
-	IsTrueFile bool      // Only in file loggers
-	Buffer     [][]byte  // only in HTTP loggers
+	Writer     io.Writer                // writer for Info(f), Warn(f), Error(f) etc.
+	URI        *uri.URI                 // URI from which the client was constructed
+	Conn       net.Conn                 // Only in network loggers
+	IsTrueFile bool                     // Only in file loggers
+	Buffer     [][]byte                 // only in HTTP loggers
+	Closer     io.Closer                // released by Close(), e.g. the listener of HTTP loggers
+	Wrap       func(net.Conn) io.Writer // converts what network loggers send, e.g. into syslog
+
+	parent       *Client       // set in clients derived by With(), which write via the parent
+	fields       []msg.Field   // sent along with every message
+	named        *named        // set in named clients, see Named
+	mu           sync.Mutex    // serializes writes and file rotation
+	written      int64         // size of the file, in rotated file loggers
+	nextRotation time.Time     // when a time-rotated file logger is due
+	closed       bool          // true upon Close()
+	spooling     bool          // true while a network logger can't connect and writes to its Spool
+	nextDial     time.Time     // when a spooling network logger tries to reconnect
+	retryStop    chan struct{} // closed by Close() to stop reconnecting in the background
+	acks         *ack.Writer   // keeps unacknowledged messages when Ack is set
+
+	qmu      sync.RWMutex  // guards starting and stopping the queue, see StartAsync
+	queue    chan queued   // messages to write, in async clients
+	drained  chan struct{} // closed when the queue is drained after Close
+	dropping int32         // 1 while async clients drop messages, so that they warn once
+	override atomic.Value  // *debugOverride, see SetDebugThresholdFor
 }
 
 func (c *Client) String() string {
 	return fmt.Sprintf("%v", c.URI)
 }
 
+// With returns a client that attaches the fields to every message that it sends, in addition to
+// the fields of c. The returned client shares c's transport (writer, connection etc.).
+func (c *Client) With(fields ...msg.Field) *Client {
+	all := make([]msg.Field, 0, len(c.fields)+len(fields))
+	all = append(append(all, c.fields...), fields...)
+	return &Client{
+		TimeFormat:     c.TimeFormat,
+		DebugThreshold: c.DebugThreshold,
+		Format:         c.Format,
+		Caller:         c.Caller,
+		Origin:         c.Origin,
+		URI:            c.URI,
+		parent:         c.transport(),
+		named:          c.named,
+		fields:         all,
+	}
+}
+
+// Trace is like Debug, but for finer-grained messages such as entering and leaving functions.
+func (c *Client) Trace(lev uint8, message string) error {
+	if !c.DebugEnabled(lev) {
+		return nil
+	}
+	return c.Output(2, msg.Trace, message)
+}
+
+func (c *Client) Tracef(lev uint8, format string, args ...interface{}) error {
+	if !c.DebugEnabled(lev) {
+		return nil
+	}
+	return c.Output(2, msg.Trace, fmt.Sprintf(format, args...))
+}
+
 func (c *Client) Debug(lev uint8, message string) error {
-	if lev > c.DebugThreshold {
+	if !c.DebugEnabled(lev) {
 		return nil
 	}
-	return c.sendToWriter(msg.Debug, message)
+	return c.Output(2, msg.Debug, message)
 }
 
 func (c *Client) Debugf(lev uint8, format string, args ...interface{}) error {
-	return c.Debug(lev, fmt.Sprintf(format, args...))
+	if !c.DebugEnabled(lev) {
+		return nil
+	}
+	return c.Output(2, msg.Debug, fmt.Sprintf(format, args...))
+}
+
+// DebugEnabled is true when Debug and Trace messages of level lev are sent, e.g. for wrappers that
+// want to skip expensive formatting.
+func (c *Client) DebugEnabled(lev uint8) bool {
+	return lev <= c.Threshold()
 }
 
 func (c *Client) Info(message string) error {
-	return c.sendToWriter(msg.Info, message)
+	return c.Output(2, msg.Info, message)
 }
 
 func (c *Client) Infof(format string, args ...interface{}) error {
-	return c.Info(fmt.Sprintf(format, args...))
+	return c.Output(2, msg.Info, fmt.Sprintf(format, args...))
+}
+
+func (c *Client) Notice(message string) error {
+	return c.Output(2, msg.Notice, message)
+}
+
+func (c *Client) Noticef(format string, args ...interface{}) error {
+	return c.Output(2, msg.Notice, fmt.Sprintf(format, args...))
 }
 
 func (c *Client) Warn(message string) error {
-	return c.sendToWriter(msg.Warn, message)
+	return c.Output(2, msg.Warn, message)
 }
 
 func (c *Client) Warnf(format string, args ...interface{}) error {
-	return c.Warn(fmt.Sprintf(format, args...))
+	return c.Output(2, msg.Warn, fmt.Sprintf(format, args...))
+}
+
+// Error sends the message and, unlike Fatal, returns.
+func (c *Client) Error(message string) error {
+	return c.Output(2, msg.Error, message)
 }
 
+func (c *Client) Errorf(format string, args ...interface{}) error {
+	return c.Output(2, msg.Error, fmt.Sprintf(format, args...))
+}
+
+// Critical sends the message and, unlike Fatal, returns.
+func (c *Client) Critical(message string) error {
+	return c.Output(2, msg.Critical, message)
+}
+
+func (c *Client) Criticalf(format string, args ...interface{}) error {
+	return c.Output(2, msg.Critical, fmt.Sprintf(format, args...))
+}
+
+// Fatal sends the message, closes all clients so that queued messages are written, and exits.
 func (c *Client) Fatal(message string) error {
-	if err := c.sendToWriter(msg.Fatal, message); err != nil {
+	return c.fatal(2, message)
+}
+
+func (c *Client) Fatalf(format string, args ...interface{}) error {
+	return c.fatal(2, fmt.Sprintf(format, args...))
+}
+
+func (c *Client) fatal(calldepth int, message string) error {
+	if err := c.Output(calldepth+1, msg.Fatal, message); err != nil {
 		return err
 	}
+	c.Close()
+	CloseAll()
 	os.Exit(1)
 	return nil // to satisfy the prototype
 }
 
-func (c *Client) Fatalf(format string, args ...interface{}) error {
-	return c.Fatal(fmt.Sprintf(format, args...))
+// Output sends a message of type t, like Info() etc. do, but a message of type msg.Fatal doesn't
+// exit. It is meant for wrappers: calldepth is the number of stack frames to skip to find the
+// caller (when Caller is set), where 1 is the caller of Output.
+func (c *Client) Output(calldepth int, t msg.MsgType, message string) error {
+	var pc uintptr
+	if c.Caller {
+		pc, _, _, _ = runtime.Caller(calldepth)
+	}
+	return c.OutputPC(pc, t, message)
+}
+
+// OutputPC is like Output, but the caller is stated as a program counter, e.g. the PC of a
+// slog.Record. A zero pc means that the caller is unknown.
+func (c *Client) OutputPC(pc uintptr, t msg.MsgType, message string) error {
+	var caller *msg.Caller
+	if c.Caller && pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		caller = msg.NewCaller(frame.File, frame.Line, frame.Function)
+	}
+	return c.sendToWriter(t, message, caller)
 }
 
 // Called by the server to pass messages already containing a timestamp etc. to clients.
+// Messages that aren't in the format of the client are converted.
 func (c *Client) Passthru(buf []byte) error {
 	if c.URI.Scheme == uri.None {
 		return nil
 	}
-	return c.write(buf)
+	t := c.transport()
+	for _, b := range msg.Convert(buf, c.Format) {
+		if t.async() && t.enqueue(msg.TypeFromBytes(b), b) {
+			continue
+		}
+		if err := t.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver is Passthru for messages that the sender wants acknowledged. It calls f once buf is
+// delivered, or with an error when it's lost. Delivered means written, and when the client has Ack
+// set, acknowledged by its server; a spooled message counts as delivered. Unlike Passthru, an
+// async client doesn't drop buf when its queue is full, but waits for room. f may be called after
+// Deliver returns, from another goroutine, but the calls are in the order of the Deliver calls.
+func (c *Client) Deliver(buf []byte, f func(error)) {
+	bufs := msg.Convert(buf, c.Format)
+	if c.URI.Scheme == uri.None || len(bufs) == 0 {
+		f(nil)
+		return
+	}
+	t := c.transport()
+	var first error
+	for i, b := range bufs {
+		last := i == len(bufs)-1
+		report := func(err error) { // earlier parts are reported before the last one
+			if first == nil {
+				first = err
+			}
+			if last {
+				f(first)
+			}
+		}
+		if t.async() && t.enqueueDelivery(b, report) {
+			continue
+		}
+		if err := t.write(b); err != nil {
+			f(err)
+			return
+		}
+		t.delivered(report)
+	}
+}
+
+// delivered calls f once the message that was just written is acknowledged, or at once when the
+// client doesn't use acknowledgements.
+func (c *Client) delivered(f func(error)) {
+	c.mu.Lock()
+	acks := c.acks
+	c.mu.Unlock()
+	if acks == nil {
+		f(nil)
+		return
+	}
+	acks.Notify(f)
 }
 
 // Called by file:// clients.
 func (c *Client) OpenFile() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openFile()
+}
+
+// openFile is OpenFile for callers that hold c.mu. A previously opened file is closed.
+func (c *Client) openFile() error {
 	if c.URI.Scheme != uri.File || c.URI.Parts[0] == "stdout" {
 		return fmt.Errorf("%v: attempt to open a file but this URI is not file-based", c)
 	}
+	if closer, ok := c.Writer.(io.Closer); ok && c.IsTrueFile {
+		closer.Close()
+	}
 	var err error
 	c.Writer, err = os.OpenFile(c.URI.Parts[0], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("%v: failed to create file: %v", c, err)
 	}
 	c.IsTrueFile = true
-	return nil
+	register(c)
+	return c.startRotation()
 }
 
-// Called by network clients (tcp:// or udp://).
+// Called by network clients (tcp://, udp://, unix://, unixgram:// or tls://). When the client has
+// a spool and can't connect, it spools messages until the connection returns.
 func (c *Client) Connect() error {
-	if c.URI.Scheme != uri.TCP && c.URI.Scheme != uri.UDP {
+	if !c.URI.Scheme.IsNetwork() {
 		return fmt.Errorf("internal foobar, client.Connect isn't meant for %v", c)
 	}
+	return c.connect(RestartAttempts)
+}
+
+// connect dials up to attempts times, and sends the spooled messages once connected.
+func (c *Client) connect(attempts int) error {
+	if c.Conn != nil {
+		c.Conn.Close()
+		c.Conn = nil
+	}
 	var err error
-	for i := 0; i < RestartAttempts; i++ {
+	for i := 0; i < attempts; i++ {
 		time.Sleep(RestartWait * time.Duration(i))
-		c.Conn, err = net.Dial(c.URI.Scheme.String(), strings.Join(c.URI.Parts, ":"))
-		if err == nil {
-			c.Writer = c.Conn
+		if c.Conn, err = c.dial(); err != nil {
+			continue
+		}
+		c.Writer = c.Conn
+		if c.Wrap != nil {
+			c.Writer = c.Wrap(c.Conn)
+		}
+		register(c)
+		if c.Ack {
+			// Unacknowledged messages of the previous connection are sent first.
+			if c.acks == nil {
+				c.acks = ack.NewWriter()
+			}
+			c.Writer = c.acks
+			if err = c.acks.Attach(c.Conn); err != nil {
+				c.Conn.Close()
+				c.Conn = nil
+				continue
+			}
+		}
+		if c.Spool == nil {
+			return nil
+		}
+		if err = c.Spool.replay(c.Writer); err == nil {
+			c.spooling = false
 			return nil
 		}
+		c.Conn.Close()
+		c.Conn = nil
+	}
+	if c.Spool == nil {
+		return fmt.Errorf("%v: failed to (re)connect: %v", c, err)
+	}
+	if !c.spooling {
+		c.warn("%v: failed to (re)connect: %v, spooling to %v", c, err, c.Spool.Dir)
+	}
+	if c.acks != nil {
+		for _, buf := range c.acks.Detach() {
+			c.spool(buf)
+		}
+		c.acks.Settle(nil)
+	}
+	register(c)
+	c.spooling = true
+	c.nextDial = time.Now().Add(SpoolRetry)
+	if c.retryStop == nil {
+		c.retryStop = make(chan struct{})
+		go c.retrySpooled(c.retryStop)
+	}
+	return nil
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	if c.URI.Scheme == uri.TLS {
+		conn, err := tls.Dial(c.URI.Scheme.Network(), c.URI.Address(), c.TLSConfig)
+		if err != nil {
+			return nil, err // not a nil *tls.Conn, that isn't a nil net.Conn
+		}
+		return conn, nil
 	}
-	return fmt.Errorf("%v: failed to (re)connect: %v", c, err)
+	return net.Dial(c.URI.Scheme.Network(), c.URI.Address())
 }
 
-func (c *Client) sendToWriter(lev msg.MsgType, message string) error {
+func (c *Client) sendToWriter(lev msg.MsgType, message string, caller *msg.Caller) error {
 	if c.URI.Scheme == uri.None {
 		return nil
 	}
 
+	t := c.transport()
 	for _, buf := range msg.BytesFromMessage(&msg.Message{
 		Type:       lev,
+		Format:     c.Format,
 		TimeFormat: c.TimeFormat,
 		Message:    message,
+		Fields:     c.fields,
+		Origin:     c.Origin,
+		Name:       c.name(),
+		Caller:     caller,
 	}) {
-		if err := c.write(buf); err != nil {
+		if t.enqueue(lev, buf) {
+			continue
+		}
+		if err := t.write(buf); err != nil {
 			return err
 		}
 	}
 
-	// If the file disappears, reopen it
-	if c.IsTrueFile {
-		_, err := os.Stat(c.URI.Parts[0])
-		if err != nil {
-			return c.OpenFile()
-		}
+	// If the file disappears, reopen it. Async clients do that after writing.
+	if t.async() {
+		return nil
 	}
+	return t.reopenIfGone()
+}
 
-	return nil
+// transport returns the client that owns the writer: c itself, or the client it was derived from.
+func (c *Client) transport() *Client {
+	if c.parent != nil {
+		return c.parent
+	}
+	return c
 }
 
 func (c *Client) write(buf []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("%v: write after Close()", c)
+	}
+
+	if c.spooling && !c.reconnectSpooled() {
+		return c.spool(buf)
+	}
+
+	if err := c.maybeRotate(len(buf)); err != nil {
+		return err
+	}
 	nWritten := 0
+	defer func() {
+		c.written += int64(nWritten)
+	}()
 	for nWritten < len(buf) {
-		n, err := c.Writer.Write(buf)
+		n, err := c.Writer.Write(buf[nWritten:])
 		if err != nil {
-			// Write errors on clients try to reconnect, if the error is due a broken pipe.
+			// Write errors on clients try to reconnect, if the error is due a dropped connection.
 			// Otherwise the error goes to the caller for handling.
-			if c.URI.Scheme != uri.TCP && c.URI.Scheme != uri.UDP || !strings.Contains(err.Error(), "broken pipe") {
+			if !c.URI.Scheme.IsNetwork() || !isDisconnect(err) {
 				return fmt.Errorf("%v: write failure: %v", c, err)
 			}
-			Warnf("%v: write failure on network client: %v", c, err)
+			c.warn("%v: write failure on network client: %v", c, err)
 			if err := c.Connect(); err != nil {
 				return err
 			}
-			n, err = c.Writer.Write(buf)
+			if c.spooling {
+				return c.spool(buf[nWritten:])
+			}
+			n, err = c.Writer.Write(buf[nWritten:])
 			if err != nil {
 				return fmt.Errorf("%v: write failure despite reconnecting: %v", c, err)
 			}
@@ -161,3 +456,16 @@ func (c *Client) write(buf []byte) error {
 	}
 	return nil
 }
+
+// isDisconnect is true when a write error means that the peer went away.
+func isDisconnect(err error) bool {
+	if errors.Is(err, ack.ErrTimeout) {
+		return true
+	}
+	for _, s := range []string{"broken pipe", "connection reset", "connection refused"} {
+		if strings.Contains(err.Error(), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,9 +2,11 @@ package client
 
 import (
 	"bytes"
+	"runtime"
 	"strings"
 	"testing"
 
+	"github.com/KarelKubat/smartlog/msg"
 	"github.com/KarelKubat/smartlog/uri"
 )
 
@@ -28,6 +30,117 @@ func TestDebugLevels(t *testing.T) {
 	}
 }
 
+func TestLevels(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		DebugThreshold: 1,
+		Writer:         buf,
+	}
+	for _, test := range []struct {
+		f          func(string) error
+		wantSuffix string
+	}{
+		{f: func(s string) error { return cl.Trace(1, s) }, wantSuffix: "| T | hello\n"},
+		{f: func(s string) error { return cl.Debug(1, s) }, wantSuffix: "| D | hello\n"},
+		{f: cl.Info, wantSuffix: "| I | hello\n"},
+		{f: cl.Notice, wantSuffix: "| N | hello\n"},
+		{f: cl.Warn, wantSuffix: "| W | hello\n"},
+		{f: cl.Error, wantSuffix: "| E | hello\n"},
+		{f: cl.Critical, wantSuffix: "| C | hello\n"},
+	} {
+		buf.Reset()
+		if err := test.f("hello"); err != nil {
+			t.Fatalf("sending = %v, need nil error", err)
+		}
+		if !strings.HasSuffix(buf.String(), test.wantSuffix) {
+			t.Errorf("sending wrote %q, want suffix %q", buf.String(), test.wantSuffix)
+		}
+	}
+
+	buf.Reset()
+	if err := cl.Trace(2, "hello"); err != nil || buf.Len() > 0 {
+		t.Errorf("cl.Trace(2,_) = %v and wrote %q, want nil error and no output above the threshold", err, buf.String())
+	}
+}
+
+func TestWith(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		Writer: buf,
+	}
+	req := cl.With(msg.String("req", "abc"))
+	user := req.With(msg.Int("user", 42))
+
+	for _, test := range []struct {
+		cl         *Client
+		wantSuffix string
+	}{
+		{
+			// parent: no fields
+			cl:         cl,
+			wantSuffix: "| I | hello\n",
+		},
+		{
+			// derived once
+			cl:         req,
+			wantSuffix: "| I | hello | req=abc\n",
+		},
+		{
+			// derived twice, fields accumulate
+			cl:         user,
+			wantSuffix: "| I | hello | req=abc user=42\n",
+		},
+	} {
+		buf.Reset()
+		if err := test.cl.Info("hello"); err != nil {
+			t.Fatalf("Info(_) = %v, need nil error", err)
+		}
+		if !strings.HasSuffix(buf.String(), test.wantSuffix) {
+			t.Errorf("Info(_) wrote %q, want suffix %q", buf.String(), test.wantSuffix)
+		}
+	}
+}
+
+func TestPassthru(t *testing.T) {
+	textLine := "now | I | hello | user=42\n"
+	jsonLine := `{"timestamp":"now","level":"info","message":"hello","fields":{"user":42}}` + "\n"
+
+	for _, test := range []struct {
+		format msg.Format
+		in     string
+		want   string
+	}{
+		{format: msg.Text, in: textLine, want: textLine},
+		{format: msg.Text, in: jsonLine, want: textLine},
+		{format: msg.JSON, in: textLine, want: jsonLine},
+		{format: msg.JSON, in: jsonLine, want: jsonLine},
+	} {
+		buf := new(bytes.Buffer)
+		cl := &Client{
+			URI: &uri.URI{
+				Scheme: uri.File,
+				Parts:  []string{"buffer"},
+			},
+			Format: test.format,
+			Writer: buf,
+		}
+		if err := cl.Passthru([]byte(test.in)); err != nil {
+			t.Fatalf("Passthru(%q) = %v, need nil error", test.in, err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("Passthru(%q) with format %v wrote %q, want %q", test.in, test.format, buf.String(), test.want)
+		}
+	}
+}
+
 func TestOpenFile(t *testing.T) {
 	for _, test := range []struct {
 		filename  string
@@ -86,6 +199,14 @@ func TestConnect(t *testing.T) {
 			uriScheme: uri.HTTP,
 			wantError: "internal foobar",
 		},
+		{
+			uriScheme: uri.Unix,
+			wantError: "failed to (re)connect",
+		},
+		{
+			uriScheme: uri.Unixgram,
+			wantError: "failed to (re)connect",
+		},
 	} {
 		cl := &Client{
 			URI: &uri.URI{
@@ -99,3 +220,69 @@ func TestConnect(t *testing.T) {
 		}
 	}
 }
+
+func TestCaller(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		DebugThreshold: 1,
+		Caller:         true,
+		Writer:         buf,
+	}
+	saved := DefaultClient
+	defer func() { DefaultClient = saved }()
+	DefaultClient = cl
+
+	// Every way of sending must report the line of the call, which is the line of the
+	// runtime.Caller() call in each function.
+	for desc, f := range map[string]func() int{
+		"Info":          func() int { _, _, l, _ := runtime.Caller(0); cl.Info("hello"); return l },
+		"Infof":         func() int { _, _, l, _ := runtime.Caller(0); cl.Infof("hello"); return l },
+		"Debugf":        func() int { _, _, l, _ := runtime.Caller(0); cl.Debugf(1, "hello"); return l },
+		"With().Error":  func() int { _, _, l, _ := runtime.Caller(0); cl.With().Error("hello"); return l },
+		"Output":        func() int { _, _, l, _ := runtime.Caller(0); cl.Output(1, msg.Warn, "hello"); return l },
+		"client.Warn":   func() int { _, _, l, _ := runtime.Caller(0); Warn("hello"); return l },
+		"client.Tracef": func() int { _, _, l, _ := runtime.Caller(0); Tracef(1, "hello"); return l },
+	} {
+		buf.Reset()
+		line := f()
+		m, err := msg.ParseStrict(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: ParseStrict(%q) = _,%v, need nil error", desc, buf.String(), err)
+		}
+		want := &msg.Caller{File: "client/client_test.go", Line: line, Function: "client.TestCaller.func"}
+		if m.Caller == nil || m.Caller.File != want.File || m.Caller.Line != want.Line || !strings.HasPrefix(m.Caller.Function, want.Function) {
+			t.Errorf("%v: caller = %+v, want %+v", desc, m.Caller, want)
+		}
+	}
+
+	// Without Caller, there's no caller info.
+	buf.Reset()
+	cl.Caller = false
+	cl.Info("hello")
+	if strings.Contains(buf.String(), "@caller") {
+		t.Errorf("Info(_) without Caller wrote %q, want no caller", buf.String())
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		Origin: &msg.Origin{Host: "web1", PID: 42, Service: "api"},
+		Writer: buf,
+	}
+	// Derived clients state the same origin.
+	if err := cl.With(msg.Int("user", 1)).Info("hello"); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+	if want := "| I | hello | @host=web1 @pid=42 @service=api user=1\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("Info(_) wrote %q, want suffix %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// openClients are all clients that opened a file or connection, or that were configured from a
+// URI, so that CloseAll and ReopenAll can find them.
+var (
+	openClientsMu sync.Mutex
+	openClients   = map[*Client]bool{}
+)
+
+func register(c *Client) {
+	openClientsMu.Lock()
+	defer openClientsMu.Unlock()
+	openClients[c] = true
+}
+
+func unregister(c *Client) {
+	openClientsMu.Lock()
+	defer openClientsMu.Unlock()
+	delete(openClients, c)
+}
+
+// OpenClients returns the clients that are open, see CloseAll. The DefaultClient isn't among them.
+func OpenClients() []*Client {
+	return registered()
+}
+
+func registered() []*Client {
+	openClientsMu.Lock()
+	defer openClientsMu.Unlock()
+	all := []*Client{}
+	for c := range openClients {
+		all = append(all, c)
+	}
+	return all
+}
+
+// Close writes all queued messages and releases the file, connection or HTTP listener of the
+// client. Afterwards the client can't send messages anymore. Clients derived by With() close
+// the client that they were derived from. Standard output is never closed.
+func (c *Client) Close() error {
+	t := c.transport()
+	err := t.StopAsync()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return err
+	}
+	t.closed = true
+	unregister(t)
+	if t.retryStop != nil {
+		close(t.retryStop)
+		t.retryStop = nil
+	}
+
+	var closer io.Closer
+	switch {
+	case t.Closer != nil:
+		closer = t.Closer
+	case t.Conn != nil:
+		closer = t.Conn
+	case t.IsTrueFile:
+		closer, _ = t.Writer.(io.Closer)
+	}
+	if t.acks != nil && !t.spooling {
+		// Wait for the server to acknowledge all messages, or spool the ones that aren't.
+		if aerr := t.acks.Wait(); aerr != nil {
+			if t.Spool == nil {
+				if err == nil {
+					err = fmt.Errorf("%v: %v", t, aerr)
+				}
+				t.acks.Settle(fmt.Errorf("%v: %v", t, aerr))
+			} else {
+				for _, buf := range t.acks.Detach() {
+					t.spool(buf)
+				}
+				t.acks.Settle(nil)
+			}
+		}
+	}
+	if t.Spool != nil {
+		t.Spool.close()
+	}
+	if closer != nil {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("%v: failed to close: %v", t, cerr)
+		}
+	}
+	return err
+}
+
+// CloseAll closes the default client and all other clients that are open. A program may call it
+// just before it exits, so that no messages are lost.
+func CloseAll() error {
+	var errs []string
+	for _, c := range append(registered(), DefaultClient) {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func isRegistered(c *Client) bool {
+	for _, r := range registered() {
+		if r == c {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "x.log")
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{name},
+		},
+	}
+	if err := cl.OpenFile(); err != nil {
+		t.Fatalf("OpenFile() = %v, need nil error", err)
+	}
+	if !isRegistered(cl) {
+		t.Errorf("client isn't registered after OpenFile()")
+	}
+	cl.StartAsync(10)
+	for i := 0; i < 5; i++ {
+		cl.Infof("message %v", i)
+	}
+
+	// Closing a derived client closes the one that it was derived from.
+	if err := cl.With().Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	if got := lines(t, name); got != 5 {
+		t.Errorf("after Close() the file has %v lines, want 5", got)
+	}
+	if isRegistered(cl) {
+		t.Errorf("client is still registered after Close()")
+	}
+	if err := cl.Info("too late"); err == nil || !strings.Contains(err.Error(), "write after Close()") {
+		t.Errorf("Info(_) after Close() = %v, want error", err)
+	}
+	if err := cl.Close(); err != nil {
+		t.Errorf("second Close() = %v, want nil error", err)
+	}
+}
+
+func TestCloseConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	defer l.Close()
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.TCP,
+			Parts:  []string{"127.0.0.1", strings.Split(l.Addr().String(), ":")[1]},
+		},
+	}
+	if err := cl.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, need nil error", err)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept() = _,%v, need nil error", err)
+	}
+	defer conn.Close()
+
+	cl.Info("bye")
+	if err := cl.Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	// The peer gets the message, and then EOF.
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(conn); err != nil {
+		t.Fatalf("ReadFrom(_) = _,%v, need nil error", err)
+	}
+	if !strings.Contains(got.String(), "| I | bye") {
+		t.Errorf("peer received %q, want the sent message", got.String())
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	saved := DefaultClient
+	defer func() { DefaultClient = saved }()
+	buf := new(bytes.Buffer)
+	DefaultClient = &Client{
+		Writer: buf,
+		URI:    saved.URI,
+	}
+	DefaultClient.StartAsync(10)
+
+	names := []string{}
+	for i := 0; i < 2; i++ {
+		names = append(names, filepath.Join(t.TempDir(), "x.log"))
+		cl := &Client{
+			URI: &uri.URI{
+				Scheme: uri.File,
+				Parts:  []string{names[i]},
+			},
+		}
+		if err := cl.OpenFile(); err != nil {
+			t.Fatalf("OpenFile() = %v, need nil error", err)
+		}
+		cl.StartAsync(10)
+		cl.Info("hello")
+	}
+	Info("hello from the default client")
+
+	if err := CloseAll(); err != nil {
+		t.Fatalf("CloseAll() = %v, need nil error", err)
+	}
+	for _, name := range names {
+		if got := lines(t, name); got != 1 {
+			t.Errorf("after CloseAll() %v has %v lines, want 1", name, got)
+		}
+	}
+	if !strings.Contains(buf.String(), "hello from the default client") {
+		t.Errorf("after CloseAll() the default client wrote %q, want the sent message", buf.String())
+	}
+	if len(registered()) != 0 {
+		t.Errorf("after CloseAll() %v clients are registered, want 0", len(registered()))
+	}
+}
@@ -1,43 +1,105 @@
 package client
 
 import (
+	"fmt"
+	"io"
 	"os"
 
+	"github.com/KarelKubat/smartlog/msg"
 	"github.com/KarelKubat/smartlog/uri"
 )
 
 var DefaultClient *Client
 
-func Debug(lev uint8, msg string) error {
-	return DefaultClient.Debug(lev, msg)
+func With(fields ...msg.Field) *Client {
+	return DefaultClient.With(fields...)
+}
+
+// The functions below call Output() of the DefaultClient directly, rather than its methods, so that
+// the caller is found at the same depth.
+
+func Trace(lev uint8, message string) error {
+	if !DefaultClient.DebugEnabled(lev) {
+		return nil
+	}
+	return DefaultClient.Output(2, msg.Trace, message)
+}
+
+func Tracef(lev uint8, format string, args ...interface{}) error {
+	if !DefaultClient.DebugEnabled(lev) {
+		return nil
+	}
+	return DefaultClient.Output(2, msg.Trace, fmt.Sprintf(format, args...))
+}
+
+func Debug(lev uint8, message string) error {
+	if !DefaultClient.DebugEnabled(lev) {
+		return nil
+	}
+	return DefaultClient.Output(2, msg.Debug, message)
 }
 
 func Debugf(lev uint8, format string, args ...interface{}) error {
-	return DefaultClient.Debugf(lev, format, args...)
+	if !DefaultClient.DebugEnabled(lev) {
+		return nil
+	}
+	return DefaultClient.Output(2, msg.Debug, fmt.Sprintf(format, args...))
 }
 
-func Info(msg string) error {
-	return DefaultClient.Info(msg)
+func Info(message string) error {
+	return DefaultClient.Output(2, msg.Info, message)
 }
 
 func Infof(format string, args ...interface{}) error {
-	return DefaultClient.Infof(format, args...)
+	return DefaultClient.Output(2, msg.Info, fmt.Sprintf(format, args...))
 }
 
-func Warn(msg string) error {
-	return DefaultClient.Warn(msg)
+func Notice(message string) error {
+	return DefaultClient.Output(2, msg.Notice, message)
+}
+
+func Noticef(format string, args ...interface{}) error {
+	return DefaultClient.Output(2, msg.Notice, fmt.Sprintf(format, args...))
+}
+
+func Warn(message string) error {
+	return DefaultClient.Output(2, msg.Warn, message)
 }
 
 func Warnf(format string, args ...interface{}) error {
-	return DefaultClient.Warnf(format, args...)
+	return DefaultClient.Output(2, msg.Warn, fmt.Sprintf(format, args...))
+}
+
+func Error(message string) error {
+	return DefaultClient.Output(2, msg.Error, message)
+}
+
+func Errorf(format string, args ...interface{}) error {
+	return DefaultClient.Output(2, msg.Error, fmt.Sprintf(format, args...))
+}
+
+func Critical(message string) error {
+	return DefaultClient.Output(2, msg.Critical, message)
 }
 
-func Fatal(msg string) error {
-	return DefaultClient.Fatal(msg)
+func Criticalf(format string, args ...interface{}) error {
+	return DefaultClient.Output(2, msg.Critical, fmt.Sprintf(format, args...))
+}
+
+func Fatal(message string) error {
+	return DefaultClient.fatal(2, message)
 }
 
 func Fatalf(format string, args ...interface{}) error {
-	return DefaultClient.Fatalf(format, args...)
+	return DefaultClient.fatal(2, fmt.Sprintf(format, args...))
+}
+
+func Named(name string) *Client {
+	return DefaultClient.Named(name)
+}
+
+func LineWriter(t msg.MsgType) io.WriteCloser {
+	return DefaultClient.LineWriter(t)
 }
 
 func init() {
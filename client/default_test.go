@@ -6,8 +6,11 @@ import (
 
 func TestDefaultClient(t *testing.T) {
 	for desc, f := range map[string]func(string) error{
-		"Info": DefaultClient.Info,
-		"Warn": DefaultClient.Warn,
+		"Info":     DefaultClient.Info,
+		"Notice":   DefaultClient.Notice,
+		"Warn":     DefaultClient.Warn,
+		"Error":    DefaultClient.Error,
+		"Critical": DefaultClient.Critical,
 	} {
 		if err := f("hello world"); err != nil {
 			t.Errorf("DefaultClient.%v(_) = %v, want nil error", desc, err)
@@ -11,11 +11,15 @@ func New(u *uri.URI) (*client.Client, error) {
 	c := &client.Client{
 		URI: u,
 	}
+	if err := c.ApplyParams(); err != nil {
+		return nil, err
+	}
 	if u.Parts[0] == "stdout" {
 		c.Writer = os.Stdout
 		return c, nil
 	}
 	if err := c.OpenFile(); err != nil {
+		c.Close() // stops the queue of an async client
 		return nil, err
 	}
 	return c, nil
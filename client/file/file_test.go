@@ -3,6 +3,7 @@ package file
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/KarelKubat/smartlog/uri"
@@ -38,3 +39,37 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestNewWithRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "x.log")
+	for _, test := range []struct {
+		params       map[string]string
+		wantRotation bool
+		wantError    bool
+	}{
+		{
+			params:       nil,
+			wantRotation: false,
+		},
+		{
+			params:       map[string]string{"rotate-size": "1M", "keep": "3"},
+			wantRotation: true,
+		},
+		{
+			params:    map[string]string{"rotate-every": "often"},
+			wantError: true,
+		},
+	} {
+		cl, err := New(&uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{name},
+			Params: test.params,
+		})
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("params %v: New() = _,%v, want error=%v", test.params, err, test.wantError)
+		}
+		if cl != nil && (cl.Rotation != nil) != test.wantRotation {
+			t.Errorf("params %v: New() gives rotation %+v, want rotation: %v", test.params, cl.Rotation, test.wantRotation)
+		}
+	}
+}
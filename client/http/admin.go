@@ -0,0 +1,127 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	h "net/http"
+	"strconv"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+)
+
+// adminHandler serves /admin/thresholds, to read and change debug thresholds at runtime:
+//
+//   - GET returns the debug thresholds of client.DefaultClient, of the open clients by URI (see
+//     client.OpenClients) and of named clients as JSON.
+//   - POST with the form values level=N, optionally client=URI or name=PATTERN, and optionally
+//     for=DURATION, sets the threshold of client.DefaultClient or of the open clients with that URI
+//     (see client.Client.SetDebugThresholdFor), or the threshold of the named clients that match
+//     PATTERN (see client.SetThresholdFor). A DURATION such as 15m makes the change expire.
+//   - POST with only the form value clear=PATTERN drops the threshold of name=PATTERN, as if it
+//     had expired (see client.ClearThreshold).
+//
+// When a token is set, requests must state it in the header "Authorization: Bearer TOKEN". Changes
+// are sent as notices by the client of the handler.
+type adminHandler struct {
+	client *client.Client
+	token  string
+}
+
+// thresholds is the JSON representation of the debug thresholds.
+type thresholds struct {
+	Threshold uint8            `json:"threshold"`         // of client.DefaultClient
+	Clients   map[string]uint8 `json:"clients,omitempty"` // of open clients, by URI
+	Names     map[string]uint8 `json:"names,omitempty"`   // of named clients
+}
+
+func (a *adminHandler) ServeHTTP(w h.ResponseWriter, r *h.Request) {
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.token)) != 1 {
+		h.Error(w, "missing or wrong token", h.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case h.MethodGet:
+	case h.MethodPost:
+		if err := a.set(r); err != nil {
+			h.Error(w, err.Error(), h.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		h.Error(w, "method not allowed", h.StatusMethodNotAllowed)
+		return
+	}
+	clients := map[string]uint8{}
+	for _, c := range client.OpenClients() {
+		clients[c.String()] = c.Threshold()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&thresholds{
+		Threshold: client.DefaultClient.Threshold(),
+		Clients:   clients,
+		Names:     client.Thresholds(),
+	})
+}
+
+// set changes a threshold from the form values of a POST request.
+func (a *adminHandler) set(r *h.Request) error {
+	if pattern := r.FormValue("clear"); pattern != "" {
+		for _, key := range []string{"level", "client", "name", "for"} {
+			if r.FormValue(key) != "" {
+				return fmt.Errorf("clear=%q and %v=%q: clear can't be combined", pattern, key, r.FormValue(key))
+			}
+		}
+		n, err := client.ClearThreshold(pattern)
+		if err != nil {
+			return err
+		}
+		a.client.Noticef("debug threshold of %q (%v named clients) cleared by %v", pattern, n, r.RemoteAddr)
+		return nil
+	}
+
+	lev, err := strconv.ParseUint(r.FormValue("level"), 10, 8)
+	if err != nil {
+		return fmt.Errorf("level=%q: must be a number from 0 to 255", r.FormValue("level"))
+	}
+	var d time.Duration
+	if s := r.FormValue("for"); s != "" {
+		if d, err = time.ParseDuration(s); err != nil || d <= 0 {
+			return fmt.Errorf("for=%q: must be a positive duration such as 15m", s)
+		}
+	}
+
+	expiry := "until changed"
+	if d > 0 {
+		expiry = fmt.Sprintf("for %v", d)
+	}
+	name, clientURI := r.FormValue("name"), r.FormValue("client")
+	switch {
+	case name != "" && clientURI != "":
+		return fmt.Errorf("name=%q and client=%q: only one of them may be given", name, clientURI)
+	case clientURI != "":
+		n := 0
+		for _, c := range client.OpenClients() {
+			if c.String() == clientURI {
+				c.SetDebugThresholdFor(uint8(lev), d)
+				n++
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("client=%q: no open client has this URI", clientURI)
+		}
+		a.client.Noticef("debug threshold of client %v set to %v %v by %v", clientURI, lev, expiry, r.RemoteAddr)
+		return nil
+	case name == "":
+		client.DefaultClient.SetDebugThresholdFor(uint8(lev), d)
+		a.client.Noticef("debug threshold of the default client set to %v %v by %v", lev, expiry, r.RemoteAddr)
+		return nil
+	}
+	n, err := client.SetThresholdFor(name, uint8(lev), d)
+	if err != nil {
+		return err
+	}
+	a.client.Noticef("debug threshold of %q (%v named clients) set to %v %v by %v", name, n, lev, expiry, r.RemoteAddr)
+	return nil
+}
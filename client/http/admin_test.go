@@ -0,0 +1,292 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	h "net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestAdmin(t *testing.T) {
+	// The test changes global state: the threshold of the default client and the pattern
+	// admintest-*. Both are restored.
+	saved := client.DefaultClient.Threshold()
+	t.Cleanup(func() {
+		client.DefaultClient.SetDebugThresholdFor(saved, 0)
+		client.ClearThreshold("admintest-*")
+	})
+	client.DefaultClient.SetDebugThresholdFor(0, 0)
+
+	buf := new(bytes.Buffer)
+	cl := &client.Client{
+		URI:    &uri.URI{Scheme: uri.File, Parts: []string{"buffer"}},
+		Writer: buf,
+	}
+	db := cl.Named("admintest-db")
+	a := &adminHandler{client: cl, token: "secret"}
+
+	// An open client, which is selected by its URI.
+	ur, err := uri.New("file://" + filepath.Join(t.TempDir(), "admintest.log"))
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	open := &client.Client{URI: ur}
+	if err := open.ApplyParams(); err != nil {
+		t.Fatalf("ApplyParams() = %v, need nil error", err)
+	}
+	defer open.Close()
+
+	for _, test := range []struct {
+		desc          string
+		method        string
+		token         string
+		form          url.Values
+		wantStatus    int
+		wantThreshold uint8 // of the default client
+		wantOpen      uint8
+		wantDB        uint8
+	}{
+		{
+			desc:       "no token",
+			method:     h.MethodGet,
+			wantStatus: h.StatusUnauthorized,
+		},
+		{
+			desc:       "wrong token",
+			method:     h.MethodGet,
+			token:      "guess",
+			wantStatus: h.StatusUnauthorized,
+		},
+		{
+			desc:       "read",
+			method:     h.MethodGet,
+			token:      "secret",
+			wantStatus: h.StatusOK,
+		},
+		{
+			desc:          "set the default client",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"3"}},
+			wantStatus:    h.StatusOK,
+			wantThreshold: 3,
+		},
+		{
+			desc:          "set an open client",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"2"}, "client": {ur.String()}},
+			wantStatus:    h.StatusOK,
+			wantThreshold: 3,
+			wantOpen:      2,
+		},
+		{
+			desc:          "set named clients",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"4"}, "name": {"admintest-*"}},
+			wantStatus:    h.StatusOK,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "bad level",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"256"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "bad duration",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"1"}, "for": {"-1m"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "bad pattern",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"1"}, "name": {"["}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "unknown client",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"1"}, "client": {"file:///nonexistent"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "client and name",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"1"}, "client": {ur.String()}, "name": {"admintest-db"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "clear with a level",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"level": {"1"}, "clear": {"admintest-*"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "clear an unknown pattern",
+			method:        h.MethodPost,
+			token:         "secret",
+			form:          url.Values{"clear": {"nonexistent"}},
+			wantStatus:    h.StatusBadRequest,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+		{
+			desc:          "bad method",
+			method:        h.MethodDelete,
+			token:         "secret",
+			wantStatus:    h.StatusMethodNotAllowed,
+			wantThreshold: 3,
+			wantOpen:      2,
+			wantDB:        4,
+		},
+	} {
+		req := httptest.NewRequest(test.method, "/admin/thresholds", strings.NewReader(test.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, req)
+		if rec.Code != test.wantStatus {
+			t.Errorf("%v: status %v, want %v", test.desc, rec.Code, test.wantStatus)
+		}
+		if rec.Code == h.StatusOK {
+			var got thresholds
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v: json.Unmarshal(%q) = %v, need nil error", test.desc, rec.Body.String(), err)
+			}
+			if got.Threshold != test.wantThreshold || got.Clients[ur.String()] != test.wantOpen || got.Names["admintest-db"] != test.wantDB {
+				t.Errorf("%v: served %+v, want threshold %v, %v for %v and %v for %q", test.desc, got, test.wantThreshold, test.wantOpen, ur, test.wantDB, "admintest-db")
+			}
+		}
+		if client.DefaultClient.Threshold() != test.wantThreshold || open.Threshold() != test.wantOpen || !db.DebugEnabled(test.wantDB) || db.DebugEnabled(test.wantDB+1) {
+			t.Errorf("%v: thresholds aren't %v, %v and %v", test.desc, test.wantThreshold, test.wantOpen, test.wantDB)
+		}
+		if cl.Threshold() != 0 {
+			t.Errorf("%v: the threshold of the handler's own client changed to %v", test.desc, cl.Threshold())
+		}
+	}
+	for _, want := range []string{
+		"| N | debug threshold of the default client set to 3 until changed by ",
+		"| N | debug threshold of client " + ur.String() + " set to 2 until changed by ",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("admin changes wrote %q, want %q", buf.String(), want)
+		}
+	}
+
+	// Changes with a duration expire.
+	for _, form := range []url.Values{
+		{"level": {"9"}, "for": {"100ms"}},
+		{"level": {"9"}, "for": {"100ms"}, "client": {ur.String()}},
+		{"level": {"9"}, "for": {"100ms"}, "name": {"admintest-db"}},
+	} {
+		req := httptest.NewRequest(h.MethodPost, "/admin/thresholds", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer secret")
+		a.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if client.DefaultClient.Threshold() != 9 || open.Threshold() != 9 || !db.DebugEnabled(9) {
+		t.Errorf("thresholds aren't 9 after setting them")
+	}
+	time.Sleep(time.Second / 5)
+	if client.DefaultClient.Threshold() != 3 || open.Threshold() != 2 || !db.DebugEnabled(4) || db.DebugEnabled(5) {
+		t.Errorf("thresholds aren't back to 3, 2 and 4 after expiry")
+	}
+
+	// A pattern can be cleared.
+	req := httptest.NewRequest(h.MethodPost, "/admin/thresholds", strings.NewReader(url.Values{"clear": {"admintest-*"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != h.StatusOK || db.DebugEnabled(1) {
+		t.Errorf("clear: status %v, want %v and the threshold of %q back to 0", rec.Code, h.StatusOK, "admintest-db")
+	}
+	if want := `| N | debug threshold of "admintest-*" (1 named clients) cleared by `; !strings.Contains(buf.String(), want) {
+		t.Errorf("admin changes wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAdminRoute(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	for _, test := range []struct {
+		params     string
+		wantStatus int
+	}{
+		{params: "", wantStatus: h.StatusNotFound}, // served by the buffer handler
+		{params: "?admin=true", wantStatus: h.StatusOK},
+		{params: "?admin-token=secret", wantStatus: h.StatusUnauthorized},
+	} {
+		ur, err := uri.New("http://" + addr + test.params)
+		if err != nil {
+			t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+		}
+		cl, err := New(ur)
+		if err != nil {
+			t.Fatalf("New(%v) = _,%v, need nil error", ur, err)
+		}
+		var resp *h.Response
+		for i := 0; i < 50 && resp == nil; i++ {
+			time.Sleep(time.Second / 100)
+			resp, _ = h.Get("http://" + addr + "/admin/thresholds")
+		}
+		if resp == nil {
+			t.Fatalf("listener on %v didn't start", addr)
+		}
+		resp.Body.Close()
+		gotStatus := resp.StatusCode
+		if gotStatus == h.StatusOK && resp.Header.Get("Content-Type") != "application/json" {
+			gotStatus = h.StatusNotFound
+		}
+		if gotStatus != test.wantStatus {
+			t.Errorf("%v: GET /admin/thresholds = %v, want %v", ur, gotStatus, test.wantStatus)
+		}
+		cl.Close()
+	}
+}
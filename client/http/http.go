@@ -2,7 +2,8 @@ package http
 
 import (
 	h "net/http"
-	"strings"
+	"strconv"
+	"sync"
 
 	"github.com/KarelKubat/smartlog/client"
 	"github.com/KarelKubat/smartlog/uri"
@@ -15,6 +16,9 @@ func New(ur *uri.URI) (*client.Client, error) {
 		URI:    ur,
 		Buffer: [][]byte{},
 	}
+	if err := c.ApplyParams(); err != nil {
+		return nil, err
+	}
 	wr := &bufferHandler{
 		client: c,
 	}
@@ -22,18 +26,31 @@ func New(ur *uri.URI) (*client.Client, error) {
 
 	mux := h.NewServeMux()
 	mux.Handle("/", wr)
+	mux.Handle("/messages", &jsonHandler{buffer: wr})
+	admin, _ := strconv.ParseBool(ur.Params["admin"]) // already checked by uri.New
+	if token := ur.Params["admin-token"]; admin || token != "" {
+		mux.Handle("/admin/thresholds", &adminHandler{client: c, token: token})
+	}
+	srv := &h.Server{
+		Addr:    ur.Address(),
+		Handler: mux,
+	}
+	c.Closer = srv // stops the listener upon c.Close()
 	go func() {
-		h.ListenAndServe(strings.Join(ur.Parts, ":"), mux)
+		srv.ListenAndServe()
 	}()
 
 	return c, nil
 }
 
 type bufferHandler struct {
+	mu     sync.Mutex // protects client.Buffer, which the handlers read while the client writes
 	client *client.Client
 }
 
 func (b *bufferHandler) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if len(b.client.Buffer) >= KeepMessages {
 		b.client.Buffer = b.client.Buffer[1:KeepMessages]
 	}
@@ -41,12 +58,9 @@ func (b *bufferHandler) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-func (b *bufferHandler) ServeHTTP(w h.ResponseWriter, r *h.Request) {
-	w.Header().Set("Content-Type", "text/html")
-
-	w.Write([]byte("<pre>"))
-	for _, b := range b.client.Buffer {
-		w.Write(b)
-	}
-	w.Write([]byte("</pre>"))
+// messages returns a copy of the stored messages, so that they can be read while Write() runs.
+func (b *bufferHandler) messages() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([][]byte(nil), b.client.Buffer...)
 }
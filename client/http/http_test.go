@@ -2,9 +2,13 @@ package http
 
 import (
 	"bytes"
+	"net"
+	h "net/http"
 	"testing"
+	"time"
 
 	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/uri"
 )
 
 func TestWrite(t *testing.T) {
@@ -101,3 +105,37 @@ func TestWrite(t *testing.T) {
 		}
 	}
 }
+
+func TestClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ur, err := uri.New("http://" + addr)
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	cl, err := New(ur)
+	if err != nil {
+		t.Fatalf("New(_) = _,%v, need nil error", err)
+	}
+	var resp *h.Response
+	for i := 0; i < 50 && resp == nil; i++ {
+		time.Sleep(time.Second / 100)
+		resp, _ = h.Get("http://" + addr)
+	}
+	if resp == nil {
+		t.Fatalf("listener on %v didn't start", addr)
+	}
+	resp.Body.Close()
+
+	if err := cl.Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	if _, err := h.Get("http://" + addr); err == nil {
+		t.Errorf("listener on %v still serves after Close()", addr)
+	}
+}
@@ -0,0 +1,283 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	h "net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// query selects stored messages, from the parameters of a request:
+//
+//   - min=TYPE, max=TYPE: the range of message types, e.g. min=warn,
+//   - since=TIME, until=TIME: the range of timestamps, where TIME is like 2006-01-02T15:04:05 (or
+//     shorter, or RFC3339), or a duration such as 15m for that long ago,
+//   - q=TEXT: messages must contain TEXT,
+//   - re=REGEXP: messages must match REGEXP,
+//   - order=newest: newest first, instead of oldest first,
+//   - per=N, page=P: show page P (from 1) of N messages, instead of all.
+type query struct {
+	min, max     msg.MsgType
+	since, until time.Time // zero: no limit
+	contains     string
+	re           *regexp.Regexp
+	newest       bool
+	per, page    int // per=0: all messages
+}
+
+// timeFormats are the formats for since= and until=, in local time.
+var timeFormats = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", time.RFC3339}
+
+func parseQuery(v url.Values) (*query, error) {
+	q := &query{
+		min:      msg.Trace,
+		max:      msg.Unknown,
+		contains: v.Get("q"),
+		newest:   v.Get("order") == "newest",
+		page:     1,
+	}
+	for _, t := range []struct {
+		key string
+		dst *msg.MsgType
+	}{{"min", &q.min}, {"max", &q.max}} {
+		s := v.Get(t.key)
+		if s == "" {
+			continue
+		}
+		if *t.dst = msg.TypeFromString(s); *t.dst == msg.Unknown && s != msg.Unknown.String() {
+			return nil, fmt.Errorf("%v=%q: unknown message type", t.key, s)
+		}
+	}
+	for _, t := range []struct {
+		key string
+		dst *time.Time
+	}{{"since", &q.since}, {"until", &q.until}} {
+		s := v.Get(t.key)
+		if s == "" {
+			continue
+		}
+		var err error
+		if *t.dst, err = parseTime(s); err != nil {
+			return nil, fmt.Errorf("%v=%q: %v", t.key, s, err)
+		}
+	}
+	if s := v.Get("re"); s != "" {
+		var err error
+		if q.re, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("re=%q: %v", s, err)
+		}
+	}
+	for _, t := range []struct {
+		key string
+		dst *int
+		min int
+	}{{"per", &q.per, 0}, {"page", &q.page, 1}} {
+		s := v.Get(t.key)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < t.min {
+			return nil, fmt.Errorf("%v=%q: must be a number, %v or more", t.key, s, t.min)
+		}
+		*t.dst = n
+	}
+	return q, nil
+}
+
+// parseTime returns the time from a since= or until= parameter.
+func parseTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, f := range timeFormats {
+		if t, err := time.ParseInLocation(f, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("must be a duration such as 15m, or a time like %v", timeFormats[0])
+}
+
+// passes returns true when a stored message is selected. timeFormat is the one of the client,
+// which the timestamp of the message is in.
+func (q *query) passes(buf []byte, timeFormat string) bool {
+	m, _ := msg.Parse(buf)
+	if m.Type < q.min || m.Type > q.max {
+		return false
+	}
+	if !q.since.IsZero() || !q.until.IsZero() {
+		m.TimeFormat = timeFormat
+		t, err := m.Time()
+		if err != nil || (!q.since.IsZero() && t.Before(q.since)) || (!q.until.IsZero() && t.After(q.until)) {
+			return false
+		}
+	}
+	if !strings.Contains(m.Message, q.contains) {
+		return false
+	}
+	return q.re == nil || q.re.MatchString(m.Message)
+}
+
+// selection is what a query selects from the stored messages.
+type selection struct {
+	messages [][]byte // on the requested page
+	total    int      // # of selected messages on all pages
+	pages    int
+}
+
+func (q *query) selectFrom(buffer [][]byte, timeFormat string) *selection {
+	selected := [][]byte{}
+	for _, b := range buffer {
+		if q.passes(b, timeFormat) {
+			selected = append(selected, b)
+		}
+	}
+	if q.newest {
+		for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+			selected[i], selected[j] = selected[j], selected[i]
+		}
+	}
+	sel := &selection{
+		messages: selected,
+		total:    len(selected),
+		pages:    1,
+	}
+	if q.per > 0 {
+		sel.pages = (len(selected) + q.per - 1) / q.per
+		from, to := (q.page-1)*q.per, q.page*q.per
+		if from > len(selected) {
+			from = len(selected)
+		}
+		if to > len(selected) {
+			to = len(selected)
+		}
+		sel.messages = selected[from:to]
+	}
+	return sel
+}
+
+// jsonSelection is the response of the JSON endpoint.
+type jsonSelection struct {
+	Total    int               `json:"total"`
+	Page     int               `json:"page"`
+	Pages    int               `json:"pages"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// jsonHandler serves the stored messages that a query selects as JSON, see query.
+type jsonHandler struct {
+	buffer *bufferHandler
+}
+
+func (j *jsonHandler) ServeHTTP(w h.ResponseWriter, r *h.Request) {
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		h.Error(w, err.Error(), h.StatusBadRequest)
+		return
+	}
+	sel := q.selectFrom(j.buffer.messages(), j.buffer.client.TimeFormat)
+	out := &jsonSelection{
+		Total:    sel.total,
+		Page:     q.page,
+		Pages:    sel.pages,
+		Messages: []json.RawMessage{},
+	}
+	for _, b := range sel.messages {
+		for _, jb := range msg.Convert(b, msg.JSON) {
+			out.Messages = append(out.Messages, json.RawMessage(jb))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// viewTemplate renders the stored messages that a query selects, with a form to change the query.
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+<form method="get">
+min <select name="min">{{range .Types}}<option{{if eq . $.Min}} selected{{end}}>{{.}}</option>{{end}}</select>
+max <select name="max">{{range .Types}}<option{{if eq . $.Max}} selected{{end}}>{{.}}</option>{{end}}</select>
+since <input name="since" value="{{.Get "since"}}" size="19" placeholder="15m or 2006-01-02T15:04">
+until <input name="until" value="{{.Get "until"}}" size="19">
+text <input name="q" value="{{.Get "q"}}">
+regexp <input name="re" value="{{.Get "re"}}">
+<select name="order"><option value="oldest">oldest first</option><option value="newest"{{if .Newest}} selected{{end}}>newest first</option></select>
+per page <input name="per" value="{{.Get "per"}}" size="4" placeholder="all">
+<input type="submit" value="show">
+</form>
+{{if .Error}}<p>{{.Error}}</p>{{else}}<p>{{.Total}} message(s), page {{.Page}} of {{.Pages}}
+{{if .Prev}}<a href="{{.Prev}}">previous</a>{{end}} {{if .Next}}<a href="{{.Next}}">next</a>{{end}}
+<a href="{{.JSON}}">JSON</a></p>
+<pre>{{range .Messages}}{{printf "%s" .}}{{end}}</pre>{{end}}
+</body>
+</html>
+`))
+
+// view is what viewTemplate renders.
+type view struct {
+	url.Values
+	Title        string
+	Types        []string
+	Min, Max     string
+	Newest       bool
+	Error        error
+	Total, Pages int
+	Page         int
+	Prev, Next   string // links to other pages, empty when there are none
+	JSON         string // link to the same selection as JSON
+	Messages     [][]byte
+}
+
+func (b *bufferHandler) ServeHTTP(w h.ResponseWriter, r *h.Request) {
+	v := r.URL.Query()
+	vw := &view{
+		Values: v,
+		Title:  fmt.Sprintf("smartlog %v", b.client),
+		Min:    msg.Trace.String(),
+		Max:    msg.Unknown.String(),
+		Newest: v.Get("order") == "newest",
+	}
+	for t := msg.Trace; t <= msg.Unknown; t++ {
+		vw.Types = append(vw.Types, t.String())
+	}
+	if s := v.Get("min"); s != "" {
+		vw.Min = s
+	}
+	if s := v.Get("max"); s != "" {
+		vw.Max = s
+	}
+
+	status := h.StatusOK
+	q, err := parseQuery(v)
+	if err != nil {
+		status, vw.Error = h.StatusBadRequest, err
+	} else {
+		sel := q.selectFrom(b.messages(), b.client.TimeFormat)
+		vw.Total, vw.Pages, vw.Page, vw.Messages = sel.total, sel.pages, q.page, sel.messages
+		vw.Prev, vw.Next = pageLink(r.URL, q.page-1, sel.pages), pageLink(r.URL, q.page+1, sel.pages)
+		vw.JSON = (&url.URL{Path: "/messages", RawQuery: r.URL.RawQuery}).String()
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	viewTemplate.Execute(w, vw)
+}
+
+// pageLink returns a link to the same query, but for another page, or "" when there's no such
+// page.
+func pageLink(u *url.URL, page, pages int) string {
+	if page < 1 || page > pages {
+		return ""
+	}
+	v := u.Query()
+	v.Set("page", strconv.Itoa(page))
+	return (&url.URL{Path: u.Path, RawQuery: v.Encode()}).String()
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	h "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// viewClient returns a client with stored messages 0 to 5, one per minute from 03:00 UTC, of type
+// info, warn, error, info etc.
+func viewClient() *client.Client {
+	cl := &client.Client{
+		TimeFormat: time.RFC3339,
+	}
+	types := []msg.MsgType{msg.Info, msg.Warn, msg.Error}
+	for i := 0; i < 6; i++ {
+		cl.Buffer = append(cl.Buffer, msg.BytesFromMessage(&msg.Message{
+			Type:      types[i%len(types)],
+			Timestamp: []byte(fmt.Sprintf("2022-01-02T03:%02d:00Z", i)),
+			Message:   fmt.Sprintf("message %v", i),
+		})...)
+	}
+	return cl
+}
+
+func TestSelect(t *testing.T) {
+	cl := viewClient()
+	for _, test := range []struct {
+		query     string
+		want      []int // numbers of the messages on the page
+		wantTotal int
+		wantPages int
+	}{
+		{query: "", want: []int{0, 1, 2, 3, 4, 5}, wantTotal: 6, wantPages: 1},
+		{query: "min=warn", want: []int{1, 2, 4, 5}, wantTotal: 4, wantPages: 1},
+		{query: "min=warn&max=warn", want: []int{1, 4}, wantTotal: 2, wantPages: 1},
+		{query: "since=2022-01-02T03:02:00Z&until=2022-01-02T03:04:00Z", want: []int{2, 3, 4}, wantTotal: 3, wantPages: 1},
+		{query: "since=1h", want: nil, wantTotal: 0, wantPages: 1},
+		{query: "q=e+3", want: []int{3}, wantTotal: 1, wantPages: 1},
+		{query: "re=[135]$", want: []int{1, 3, 5}, wantTotal: 3, wantPages: 1},
+		{query: "order=newest", want: []int{5, 4, 3, 2, 1, 0}, wantTotal: 6, wantPages: 1},
+		{query: "per=4", want: []int{0, 1, 2, 3}, wantTotal: 6, wantPages: 2},
+		{query: "per=4&page=2", want: []int{4, 5}, wantTotal: 6, wantPages: 2},
+		{query: "per=4&page=3", want: nil, wantTotal: 6, wantPages: 2},
+		{query: "per=2&page=2&order=newest&min=info&max=warn", want: []int{1, 0}, wantTotal: 4, wantPages: 2},
+	} {
+		v, _ := url.ParseQuery(test.query)
+		q, err := parseQuery(v)
+		if err != nil {
+			t.Fatalf("parseQuery(%q) = _,%v, need nil error", test.query, err)
+		}
+		sel := q.selectFrom(cl.Buffer, cl.TimeFormat)
+		var got []int
+		for _, b := range sel.messages {
+			m, _ := msg.Parse(b)
+			var n int
+			fmt.Sscanf(m.Message, "message %d", &n)
+			got = append(got, n)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) || sel.total != test.wantTotal || sel.pages != test.wantPages {
+			t.Errorf("%q: selected %v, total %v, pages %v, want %v, %v, %v", test.query, got, sel.total, sel.pages, test.want, test.wantTotal, test.wantPages)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"min=loud",
+		"max=%3F%21",
+		"since=yesterday",
+		"until=2022-13-01",
+		"re=(",
+		"per=-1",
+		"page=0",
+		"page=x",
+	} {
+		v, _ := url.ParseQuery(query)
+		if _, err := parseQuery(v); err == nil {
+			t.Errorf("parseQuery(%q) = _,nil, need error", query)
+		}
+	}
+}
+
+func TestViewHandlers(t *testing.T) {
+	cl := viewClient()
+	cl.Buffer = append(cl.Buffer, msg.BytesFromMessage(&msg.Message{
+		Type:      msg.Info,
+		Timestamp: []byte("2022-01-02T03:06:00Z"),
+		Message:   "<script>",
+	})...)
+	b := &bufferHandler{client: cl}
+
+	// HTML
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/?min=warn&per=2", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"4 message(s), page 1 of 2",
+		`<option selected>warn</option>`,
+		"| W | message 1\n",
+		"| E | message 2\n",
+		`<a href="/?min=warn&amp;page=2&amp;per=2">next</a>`,
+		`<a href="/messages?min=warn&amp;per=2">JSON</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("HTML view %q doesn't contain %q", body, want)
+		}
+	}
+	if strings.Contains(body, "previous") || strings.Contains(body, "message 4") {
+		t.Errorf("HTML view %q shows more than page 1", body)
+	}
+
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/?q=script", nil))
+	if body := rec.Body.String(); strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("HTML view %q doesn't escape messages", body)
+	}
+
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/?re=(", nil))
+	if rec.Code != h.StatusBadRequest || !strings.Contains(rec.Body.String(), "re=&#34;(&#34;") {
+		t.Errorf("HTML view of a bad query = %v %q, want %v and the error", rec.Code, rec.Body.String(), h.StatusBadRequest)
+	}
+
+	// JSON
+	j := &jsonHandler{buffer: b}
+	rec = httptest.NewRecorder()
+	j.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/messages?min=warn&per=2&page=2&order=newest", nil))
+	var got struct {
+		Total    int
+		Page     int
+		Pages    int
+		Messages []struct {
+			Level   string
+			Message string
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q) = %v, need nil error", rec.Body.String(), err)
+	}
+	if want := `{4 2 2 [{error message 2} {warn message 1}]}`; fmt.Sprint(got) != want {
+		t.Errorf("JSON view = %v, want %v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	j.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/messages?min=loud", nil))
+	if rec.Code != h.StatusBadRequest {
+		t.Errorf("JSON view of a bad query = %v, want %v", rec.Code, h.StatusBadRequest)
+	}
+}
+
+func TestViewWhileWriting(t *testing.T) {
+	cl := &client.Client{
+		URI: &uri.URI{Scheme: uri.HTTP, Parts: []string{"localhost:0"}},
+	}
+	b := &bufferHandler{client: cl}
+	cl.Writer = b
+	j := &jsonHandler{buffer: b}
+
+	defer func(n int) { KeepMessages = n }(KeepMessages)
+	KeepMessages = 10
+
+	written := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			cl.Infof("message %v", i)
+		}
+		close(written)
+	}()
+	for done := false; !done; {
+		select {
+		case <-written:
+			done = true
+		default:
+		}
+		for _, handler := range []h.Handler{b, j} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/?q=message", nil))
+			if rec.Code != h.StatusOK {
+				t.Fatalf("status %v while writing, want %v", rec.Code, h.StatusOK)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	j.ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/messages?order=newest&per=1", nil))
+	if want := `"total":10,`; !strings.Contains(rec.Body.String(), want) || !strings.Contains(rec.Body.String(), "message 99") {
+		t.Errorf("JSON view after writing = %q, want %q and the last message", rec.Body.String(), want)
+	}
+}
+
+func TestViewHidesToken(t *testing.T) {
+	ur, err := uri.New("http://127.0.0.1:8080?admin-token=s3cret")
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	cl := viewClient()
+	cl.URI = ur
+	rec := httptest.NewRecorder()
+	(&bufferHandler{client: cl}).ServeHTTP(rec, httptest.NewRequest(h.MethodGet, "/", nil))
+	if body := rec.Body.String(); strings.Contains(body, "s3cret") || !strings.Contains(body, "admin-token=redacted") {
+		t.Errorf("HTML view %q shows the admin token", body)
+	}
+}
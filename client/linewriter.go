@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/KarelKubat/smartlog/linebuf"
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// lineWriter is returned by LineWriter().
+type lineWriter struct {
+	c      *Client
+	t      msg.MsgType
+	mu     sync.Mutex
+	line   *linebuf.Linebuf
+	closed bool
+}
+
+// LineWriter returns a writer that sends every line that is written to it as a message of type t,
+// e.g. to capture the output of a library or of an exec.Cmd. Trailing "\r\n" or "\n" is removed,
+// empty lines are skipped. Close() sends a trailing partial line; it doesn't close c.
+//
+// Lines are always sent: msg.Debug and msg.Trace aren't subject to the DebugThreshold, and
+// msg.Fatal doesn't exit.
+func (c *Client) LineWriter(t msg.MsgType) io.WriteCloser {
+	return &lineWriter{
+		c:    c,
+		t:    t,
+		line: linebuf.New(),
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("%v: write to a line writer after Close()", w.c)
+	}
+	w.line.Add(p, len(p))
+	for w.line.Complete() {
+		if err := w.send(w.line.Statement()); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	rest := w.line.Bytes()
+	w.line.Reset()
+	return w.send(rest)
+}
+
+// send sends a line, unless it's empty.
+func (w *lineWriter) send(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return nil
+	}
+	return w.c.OutputPC(0, w.t, string(line))
+}
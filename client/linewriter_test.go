@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestLineWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		Writer: buf,
+	}
+
+	for _, test := range []struct {
+		desc   string
+		writes []string
+		t      msg.MsgType
+		want   []string
+	}{
+		{
+			desc:   "one line",
+			writes: []string{"hello\n"},
+			t:      msg.Info,
+			want:   []string{"hello"},
+		},
+		{
+			desc:   "lines split across writes",
+			writes: []string{"hel", "lo\nwor", "ld\n"},
+			t:      msg.Warn,
+			want:   []string{"hello", "world"},
+		},
+		{
+			desc:   "several lines in one write, CRLF and empty lines",
+			writes: []string{"a\r\n\nb\n\r\nc\n"},
+			t:      msg.Error,
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			desc:   "partial line flushed by Close",
+			writes: []string{"a\nb"},
+			t:      msg.Debug,
+			want:   []string{"a", "b"},
+		},
+		{
+			desc: "nothing written",
+			t:    msg.Info,
+		},
+	} {
+		buf.Reset()
+		w := cl.LineWriter(test.t)
+		for _, s := range test.writes {
+			if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+				t.Errorf("%v: Write(%q) = %v,%v, want %v,nil", test.desc, s, n, err, len(s))
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("%v: Close() = %v, need nil error", test.desc, err)
+		}
+		var got []string
+		for _, line := range bytes.SplitAfter(buf.Bytes(), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			m, err := msg.ParseStrict(line)
+			if err != nil {
+				t.Fatalf("%v: ParseStrict(%q) = _,%v, need nil error", test.desc, line, err)
+			}
+			if m.Type != test.t {
+				t.Errorf("%v: sent type %v, want %v", test.desc, m.Type, test.t)
+			}
+			got = append(got, m.Message)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: sent %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	// The standard log package can write to a line writer.
+	buf.Reset()
+	w := cl.LineWriter(msg.Notice)
+	l := log.New(w, "lib: ", 0)
+	l.Printf("%v rows", 42)
+	if want := "| N | lib: 42 rows\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("log.Printf() wrote %q, want suffix %q", buf.String(), want)
+	}
+
+	// Writes after Close fail, closing again doesn't.
+	w.Close()
+	if _, err := w.Write([]byte("hello\n")); err == nil {
+		t.Errorf("Write() after Close() = _,nil, need error")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close() = %v, need nil error", err)
+	}
+}
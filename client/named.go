@@ -0,0 +1,240 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// named is shared by all named clients with the same name, see Named().
+type named struct {
+	name      string
+	base      int32 // threshold from the client that the first one was derived from
+	threshold int32 // accessed atomically, since SetThreshold() may run at any time
+}
+
+// debugOverride is a threshold from SetDebugThresholdFor(). Temporary overrides stack: earlier is
+// the override that applies again once this one has expired.
+type debugOverride struct {
+	lev     uint8
+	expired int32 // 1 once expired, accessed atomically
+	earlier *debugOverride
+}
+
+// live returns the first override in the stack that hasn't expired, or nil.
+func (o *debugOverride) live() *debugOverride {
+	for ; o != nil; o = o.earlier {
+		if atomic.LoadInt32(&o.expired) == 0 {
+			return o
+		}
+	}
+	return nil
+}
+
+// patternThreshold is a debug threshold that SetThreshold() gave to a pattern of names.
+type patternThreshold struct {
+	pattern string
+	lev     uint8
+}
+
+// names are the names of all named clients, and patterns are the thresholds set by SetThreshold(),
+// oldest first.
+var (
+	namesMu  sync.Mutex
+	names    = map[string]*named{}
+	patterns []*patternThreshold
+)
+
+// Named returns a client that states its name in every message and has a debug threshold of its
+// own, e.g. for a subsystem. The client shares c's transport, like clients from With() do. The
+// name of a client derived from a named client is prefixed with the parent's name and a dot:
+// c.Named("db").Named("pool") is named "db.pool".
+//
+// Named clients with the same name share their threshold. It's initially the one of the latest
+// SetThreshold() pattern that matches the name, or else the one of c. Setting the DebugThreshold
+// of a named client has no effect, use SetThreshold() instead.
+func (c *Client) Named(name string) *Client {
+	if c.named != nil {
+		name = c.named.name + "." + name
+	}
+	nc := c.With()
+	nc.named = lookupName(name, c.Threshold())
+	return nc
+}
+
+// lookupName returns the shared state of a name, which is created when the name is new.
+func lookupName(name string, lev uint8) *named {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	if n, ok := names[name]; ok {
+		return n
+	}
+	n := &named{name: name, base: int32(lev)}
+	n.threshold = n.fromPatterns()
+	names[name] = n
+	return n
+}
+
+// fromPatterns returns the threshold of the latest pattern that matches the name, or else the
+// base threshold. The caller must hold namesMu.
+func (n *named) fromPatterns() int32 {
+	threshold := n.base
+	for _, p := range patterns {
+		if ok, _ := path.Match(p.pattern, n.name); ok {
+			threshold = int32(p.lev)
+		}
+	}
+	return threshold
+}
+
+// SetThreshold sets the debug threshold of named clients whose names match pattern, such as
+// "db" or "db.*" (see path.Match). Named clients that are created later get it too. The return
+// value is the number of existing names that match.
+func SetThreshold(pattern string, lev uint8) (int, error) {
+	return SetThresholdFor(pattern, lev, 0)
+}
+
+// SetThresholdFor is like SetThreshold, but the threshold expires after d, unless d is zero. Upon
+// expiry the pattern is dropped, and named clients that match it get the threshold of the latest
+// remaining pattern that matches, or else the one of their parent.
+func SetThresholdFor(pattern string, lev uint8, d time.Duration) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, fmt.Errorf("pattern %q: %v", pattern, err)
+	}
+
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	p := &patternThreshold{pattern: pattern, lev: lev}
+	kept := []*patternThreshold{}
+	for _, q := range patterns {
+		if q.pattern != pattern {
+			kept = append(kept, q)
+		}
+	}
+	patterns = append(kept, p)
+
+	n := 0
+	for name, nm := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			atomic.StoreInt32(&nm.threshold, int32(lev))
+			n++
+		}
+	}
+	if d > 0 {
+		time.AfterFunc(d, func() { expire(p) })
+	}
+	return n, nil
+}
+
+// ClearThreshold drops the threshold that SetThreshold() or SetThresholdFor() gave to pattern, as
+// if it had expired. The return value is the number of existing names that match; it's an error
+// when pattern has no threshold.
+func ClearThreshold(pattern string) (int, error) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	for _, p := range patterns {
+		if p.pattern == pattern {
+			return drop(p), nil
+		}
+	}
+	return 0, fmt.Errorf("pattern %q: no threshold is set", pattern)
+}
+
+// expire undoes SetThresholdFor() when it expires. Nothing happens when the pattern was set again
+// or cleared in the meantime.
+func expire(p *patternThreshold) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	for _, q := range patterns {
+		if q == p {
+			drop(p)
+			return
+		}
+	}
+}
+
+// drop removes p from the patterns, and re-evaluates the names that match it against the remaining
+// patterns. The number of these names is returned. The caller must hold namesMu.
+func drop(p *patternThreshold) int {
+	kept := []*patternThreshold{}
+	for _, q := range patterns {
+		if q != p {
+			kept = append(kept, q)
+		}
+	}
+	patterns = kept
+
+	n := 0
+	for name, nm := range names {
+		if ok, _ := path.Match(p.pattern, name); ok {
+			atomic.StoreInt32(&nm.threshold, nm.fromPatterns())
+			n++
+		}
+	}
+	return n
+}
+
+// Thresholds returns the names of all named clients, with their debug thresholds.
+func Thresholds() map[string]uint8 {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	ret := map[string]uint8{}
+	for name, nm := range names {
+		ret[name] = uint8(atomic.LoadInt32(&nm.threshold))
+	}
+	return ret
+}
+
+// SetDebugThresholdFor overrides the DebugThreshold of c. Unlike setting DebugThreshold, it may be
+// called while other goroutines send. When d isn't zero, the override expires after d: the latest
+// override that hasn't expired yet comes back, or else DebugThreshold. An override without expiry
+// discards all earlier ones. Clients that were derived from c using With() don't see it, and named
+// clients ignore it: use SetThresholdFor() for these.
+func (c *Client) SetDebugThresholdFor(lev uint8, d time.Duration) {
+	o := &debugOverride{lev: lev}
+	for {
+		current := c.override.Load()
+		if d > 0 {
+			earlier, _ := current.(*debugOverride)
+			o.earlier = earlier.live()
+		}
+		if c.override.CompareAndSwap(current, o) {
+			break
+		}
+	}
+	if d > 0 {
+		time.AfterFunc(d, func() {
+			atomic.StoreInt32(&o.expired, 1)
+			c.override.CompareAndSwap(o, o.earlier.live()) // keeps the stack short
+		})
+	}
+}
+
+// Threshold returns the debug threshold that applies to c: the one of its name for named clients,
+// else the one of SetDebugThresholdFor(), else DebugThreshold.
+func (c *Client) Threshold() uint8 {
+	if c.named != nil {
+		return uint8(atomic.LoadInt32(&c.named.threshold))
+	}
+	if o, _ := c.override.Load().(*debugOverride); o != nil {
+		if o = o.live(); o != nil {
+			return o.lev
+		}
+	}
+	return c.DebugThreshold
+}
+
+// name returns the name of a named client, or "".
+func (c *Client) name() string {
+	if c.named != nil {
+		return c.named.name
+	}
+	return ""
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestNamed(t *testing.T) {
+	names = map[string]*named{}
+	patterns = nil
+
+	buf := new(bytes.Buffer)
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		DebugThreshold: 1,
+		Writer:         buf,
+	}
+	db := cl.Named("db")
+	pool := db.Named("pool")
+	http := cl.With(msg.String("k", "v")).Named("http")
+
+	// Named clients start with the threshold of their parent, and state their names.
+	for _, test := range []struct {
+		c        *Client
+		wantName string
+		wantText string
+	}{
+		{c: cl, wantText: "| D | hello\n"},
+		{c: db, wantName: "db", wantText: "| D | hello | @name=db\n"},
+		{c: pool, wantName: "db.pool", wantText: "| D | hello | @name=db.pool\n"},
+		{c: http, wantName: "http", wantText: "| D | hello | @name=http k=v\n"},
+		{c: http.With(msg.Int("n", 1)), wantName: "http", wantText: "| D | hello | @name=http k=v n=1\n"},
+	} {
+		buf.Reset()
+		test.c.Debug(1, "hello")
+		if !strings.HasSuffix(buf.String(), test.wantText) {
+			t.Errorf("%q: Debug() wrote %q, want suffix %q", test.wantName, buf.String(), test.wantText)
+		}
+	}
+
+	// Thresholds change by pattern, for existing and new names.
+	for _, test := range []struct {
+		pattern string
+		lev     uint8
+		want    int
+	}{
+		{pattern: "db*", lev: 3, want: 2},
+		{pattern: "http", lev: 0, want: 1},
+		{pattern: "nothing", lev: 5, want: 0},
+	} {
+		if got, err := SetThreshold(test.pattern, test.lev); got != test.want || err != nil {
+			t.Errorf("SetThreshold(%q, %v) = %v,%v, want %v,nil", test.pattern, test.lev, got, err, test.want)
+		}
+	}
+	if _, err := SetThreshold("[", 1); err == nil {
+		t.Errorf("SetThreshold(%q, 1) = _,nil, need error", "[")
+	}
+	cache := pool.Named("cache") // "db*" doesn't match "db.pool.cache", but the parent threshold applies
+	nothing := cl.Named("nothing")
+	want := map[string]uint8{"db": 3, "db.pool": 3, "db.pool.cache": 3, "http": 0, "nothing": 5}
+	if got := Thresholds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Thresholds() = %v, want %v", got, want)
+	}
+
+	for _, test := range []struct {
+		c    *Client
+		lev  uint8
+		want bool
+	}{
+		{c: cl, lev: 1, want: true},
+		{c: cl, lev: 2, want: false},
+		{c: db, lev: 3, want: true},
+		{c: db.With(), lev: 3, want: true},
+		{c: pool, lev: 4, want: false},
+		{c: cache, lev: 3, want: true},
+		{c: http, lev: 1, want: false},
+		{c: nothing, lev: 5, want: true},
+		{c: cl.Named("db"), lev: 3, want: true}, // same name, same threshold
+	} {
+		if got := test.c.DebugEnabled(test.lev); got != test.want {
+			t.Errorf("%q: DebugEnabled(%v) = %v, want %v", test.c.name(), test.lev, got, test.want)
+		}
+	}
+
+	// The DebugThreshold of named clients is unused.
+	db.DebugThreshold = 0
+	if !db.DebugEnabled(3) {
+		t.Errorf("DebugEnabled(3) = false after setting DebugThreshold, want the threshold of SetThreshold()")
+	}
+}
+
+func TestSetThresholdFor(t *testing.T) {
+	names = map[string]*named{}
+	patterns = nil
+
+	cl := &Client{
+		URI:            &uri.URI{Scheme: uri.None, Parts: []string{"none"}},
+		DebugThreshold: 1,
+	}
+	db := cl.Named("db")
+	http := cl.Named("http")
+	SetThreshold("http", 2)
+
+	if n, err := SetThresholdFor("*", 5, time.Second/10); n != 2 || err != nil {
+		t.Fatalf("SetThresholdFor(%q, 5, _) = %v,%v, want 2,nil", "*", n, err)
+	}
+	cache := cl.Named("cache") // created while the pattern holds
+	SetThreshold("db", 7)      // changed while the pattern holds
+	want := map[string]uint8{"db": 7, "http": 5, "cache": 5}
+	if got := Thresholds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Thresholds() before expiry = %v, want %v", got, want)
+	}
+
+	time.Sleep(time.Second / 5)
+	want = map[string]uint8{"db": 7, "http": 2, "cache": 1}
+	if got := Thresholds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Thresholds() after expiry = %v, want %v", got, want)
+	}
+	if n := len(patterns); n != 2 {
+		t.Errorf("%v patterns after expiry, want 2", n)
+	}
+	for _, c := range []*Client{db, http, cache} {
+		if !c.DebugEnabled(1) {
+			t.Errorf("%q: DebugEnabled(1) = false, want true", c.name())
+		}
+	}
+
+	// Setting the pattern again overrides its expiry.
+	SetThresholdFor("http", 3, time.Second/10)
+	SetThreshold("http", 3)
+	time.Sleep(time.Second / 5)
+	if got := Thresholds()["http"]; got != 3 {
+		t.Errorf("threshold of %q = %v, want 3", "http", got)
+	}
+}
+
+func TestSetDebugThresholdFor(t *testing.T) {
+	cl := &Client{
+		URI:            &uri.URI{Scheme: uri.None, Parts: []string{"none"}},
+		DebugThreshold: 1,
+	}
+	for _, test := range []struct {
+		lev  uint8
+		d    time.Duration
+		want uint8
+	}{
+		{lev: 3, want: 3},
+		{lev: 0, want: 0},
+		{lev: 5, d: time.Hour, want: 5},
+		{lev: 7, d: time.Second / 10, want: 7},
+	} {
+		cl.SetDebugThresholdFor(test.lev, test.d)
+		if got := cl.Threshold(); got != test.want {
+			t.Errorf("Threshold() after SetDebugThresholdFor(%v, %v) = %v, want %v", test.lev, test.d, got, test.want)
+		}
+	}
+
+	// The expiry of 7 restores 5.
+	time.Sleep(time.Second / 5)
+	if got := cl.Threshold(); got != 5 {
+		t.Errorf("Threshold() after expiry = %v, want 5", got)
+	}
+	if !cl.DebugEnabled(5) || cl.DebugEnabled(6) {
+		t.Errorf("DebugEnabled() doesn't follow the threshold 5")
+	}
+}
+
+func TestOverlappingThresholdsFor(t *testing.T) {
+	names = map[string]*named{}
+	patterns = nil
+
+	cl := &Client{URI: &uri.URI{Scheme: uri.None, Parts: []string{"none"}}}
+	db := cl.Named("db")
+
+	// An override that expires first doesn't come back when a later one expires.
+	cl.SetDebugThresholdFor(5, time.Second/20)
+	cl.SetDebugThresholdFor(9, time.Second*3/20)
+	SetThresholdFor("db", 5, time.Second/20)
+	SetThresholdFor("*", 9, time.Second*3/20)
+	time.Sleep(time.Second / 10)
+	if got := cl.Threshold(); got != 9 {
+		t.Errorf("Threshold() after the first expiry = %v, want 9", got)
+	}
+	if got := db.Threshold(); got != 9 {
+		t.Errorf("%q: Threshold() after the first expiry = %v, want 9", "db", got)
+	}
+	time.Sleep(time.Second / 5)
+	if got := cl.Threshold(); got != 0 {
+		t.Errorf("Threshold() after both expiries = %v, want 0", got)
+	}
+	if got := db.Threshold(); got != 0 {
+		t.Errorf("%q: Threshold() after both expiries = %v, want 0", "db", got)
+	}
+
+	// A longer override that was set first comes back when a shorter one expires.
+	cl.SetDebugThresholdFor(5, time.Second*3/20)
+	cl.SetDebugThresholdFor(9, time.Second/20)
+	SetThresholdFor("*", 5, time.Second*3/20)
+	SetThresholdFor("db", 9, time.Second/20)
+	time.Sleep(time.Second / 10)
+	if got := cl.Threshold(); got != 5 {
+		t.Errorf("Threshold() after the shorter expiry = %v, want 5", got)
+	}
+	if got := db.Threshold(); got != 5 {
+		t.Errorf("%q: Threshold() after the shorter expiry = %v, want 5", "db", got)
+	}
+	time.Sleep(time.Second / 5)
+	if got := cl.Threshold(); got != 0 {
+		t.Errorf("Threshold() after both expiries = %v, want 0", got)
+	}
+	if got := db.Threshold(); got != 0 {
+		t.Errorf("%q: Threshold() after both expiries = %v, want 0", "db", got)
+	}
+}
+
+func TestClearThreshold(t *testing.T) {
+	names = map[string]*named{}
+	patterns = nil
+
+	cl := &Client{
+		URI:            &uri.URI{Scheme: uri.None, Parts: []string{"none"}},
+		DebugThreshold: 1,
+	}
+	cl.Named("db")
+	cl.Named("http")
+	SetThreshold("*", 2)
+	SetThreshold("db", 5)
+
+	if n, err := ClearThreshold("db"); n != 1 || err != nil {
+		t.Errorf("ClearThreshold(%q) = %v,%v, want 1,nil", "db", n, err)
+	}
+	if want := map[string]uint8{"db": 2, "http": 2}; !reflect.DeepEqual(Thresholds(), want) {
+		t.Errorf("Thresholds() after clearing %q = %v, want %v", "db", Thresholds(), want)
+	}
+	if n, err := ClearThreshold("*"); n != 2 || err != nil {
+		t.Errorf("ClearThreshold(%q) = %v,%v, want 2,nil", "*", n, err)
+	}
+	if want := map[string]uint8{"db": 1, "http": 1}; !reflect.DeepEqual(Thresholds(), want) {
+		t.Errorf("Thresholds() after clearing %q = %v, want %v", "*", Thresholds(), want)
+	}
+	if _, err := ClearThreshold("*"); err == nil {
+		t.Errorf("ClearThreshold(%q) of a cleared pattern = _,nil, want error", "*")
+	}
+}
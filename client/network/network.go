@@ -9,7 +9,11 @@ func New(ur *uri.URI) (*client.Client, error) {
 	c := &client.Client{
 		URI: ur,
 	}
+	if err := c.ApplyParams(); err != nil {
+		return nil, err
+	}
 	if err := c.Connect(); err != nil {
+		c.Close() // stops the queue of an async client
 		return nil, err
 	}
 	return c, nil
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/tlsconfig"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// ApplyParams configures the client from the parameters of its URI (?key=value&...). The
+// constructors in the subpackages of client call it, so that any client can be configured from
+// just a string. The uri package has already checked that the values are valid. The client is
+// registered and its queue is started only when all parameters could be applied, so that nothing
+// needs to be undone when it fails.
+func (c *Client) ApplyParams() error {
+	var err error
+	for key, value := range c.URI.Params {
+		switch key {
+		case "format":
+			c.Format, err = msg.FormatFromString(value)
+		case "rotate-size", "rotate-every", "keep", "compress":
+			// handled below, all at once
+		case "buffer":
+			// handled below, last
+		case "spool", "spool-size":
+			// handled below, all at once
+		case "facility", "app", "hostname", "procid":
+			// handled by package client/syslog
+		case "admin", "admin-token":
+			// handled by package client/http
+		case "origin", "service":
+			// handled below, all at once
+		case "ack":
+			c.Ack, _ = strconv.ParseBool(value) // already checked by uri.New
+		default:
+			if !tlsconfig.IsClientParam(key) { // those are handled below, all at once
+				err = fmt.Errorf("parameter %q is not supported by clients", key) // e.g. hops, for servers
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", c, err)
+		}
+	}
+	origin, _ := strconv.ParseBool(c.URI.Params["origin"])
+	if service := c.URI.Params["service"]; origin || service != "" {
+		c.Origin = msg.NewOrigin(service)
+	}
+	if c.URI.Scheme == uri.File {
+		if c.Rotation, err = RotationFromParams(c.URI.Params); err != nil {
+			return fmt.Errorf("%v: %v", c, err)
+		}
+	}
+	if c.URI.Scheme.IsNetwork() {
+		if c.Spool, err = SpoolFromParams(c.URI.Params); err != nil {
+			return fmt.Errorf("%v: %v", c, err)
+		}
+	}
+	if c.URI.Scheme == uri.TLS {
+		if c.TLSConfig, err = tlsconfig.ForClient(c.URI); err != nil {
+			return err
+		}
+	}
+	register(c) // so that CloseAll finds it
+	if value, ok := c.URI.Params["buffer"]; ok {
+		size, _ := strconv.Atoi(value) // already checked by uri.New
+		if err := c.StartAsync(size); err != nil {
+			unregister(c)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestApplyParams(t *testing.T) {
+	for _, test := range []struct {
+		u            string
+		wantFormat   msg.Format
+		wantRotation bool
+		wantAsync    bool
+		wantService  string // when not empty, the client must have an origin with this service
+		wantError    string
+	}{
+		{
+			u:          "file://stdout",
+			wantFormat: msg.Text,
+		},
+		{
+			u:          "tcp://localhost:2022?format=json",
+			wantFormat: msg.JSON,
+		},
+		{
+			u:            "file:///tmp/x.log?format=json&rotate-size=1M",
+			wantFormat:   msg.JSON,
+			wantRotation: true,
+		},
+		{
+			u:          "tcp://localhost:2022?buffer=100",
+			wantFormat: msg.Text,
+			wantAsync:  true,
+		},
+		{
+			u:           "file://stdout?service=api",
+			wantFormat:  msg.Text,
+			wantService: "api",
+		},
+		{
+			u:         "tls://localhost:2022?verify-client=true",
+			wantError: "not supported by clients",
+		},
+		{
+			u:         "tcp://localhost:2022?buffer=10&spool-size=1M",
+			wantError: "needs spool=DIR",
+		},
+	} {
+		ur, err := uri.New(test.u)
+		if err != nil {
+			t.Fatalf("uri.New(%q) = _,%v, need nil error", test.u, err)
+		}
+		cl := &Client{
+			URI: ur,
+		}
+		err = cl.ApplyParams()
+		switch {
+		case test.wantError != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%v: ApplyParams() = %v, want error with %q", test.u, err, test.wantError)
+			}
+			if cl.async() || isRegistered(cl) {
+				t.Errorf("%v: failing ApplyParams() leaves async %v and registered %v, want neither", test.u, cl.async(), isRegistered(cl))
+			}
+		case err != nil:
+			t.Errorf("%v: ApplyParams() = %v, want nil error", test.u, err)
+		case cl.Format != test.wantFormat || (cl.Rotation != nil) != test.wantRotation:
+			t.Errorf("%v: ApplyParams() gives format %v and rotation %+v, want %v and rotation: %v",
+				test.u, cl.Format, cl.Rotation, test.wantFormat, test.wantRotation)
+		case cl.async() != test.wantAsync:
+			t.Errorf("%v: ApplyParams() gives async %v, want %v", test.u, cl.async(), test.wantAsync)
+		case test.wantService != "" && (cl.Origin == nil || cl.Origin.Service != test.wantService):
+			t.Errorf("%v: ApplyParams() gives origin %+v, want service %q", test.u, cl.Origin, test.wantService)
+		case test.wantService == "" && cl.Origin != nil:
+			t.Errorf("%v: ApplyParams() gives origin %+v, want none", test.u, cl.Origin)
+		}
+		cl.Close()
+	}
+}
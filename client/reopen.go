@@ -0,0 +1,47 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reopen closes and reopens the file of a file:// client, e.g. after an external logrotate
+// has moved it away. Messages that are being written meanwhile go either completely into the
+// old file, or completely into the new one. Clients that don't write to a true file are left alone.
+func (c *Client) Reopen() error {
+	t := c.transport()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.IsTrueFile || t.closed {
+		return nil
+	}
+	return t.openFile()
+}
+
+// ReopenAll reopens all files of open file:// clients. This is what a SIGHUP handler should call.
+func ReopenAll() error {
+	var errs []string
+	for _, c := range registered() {
+		if err := c.Reopen(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to reopen: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reopenIfGone reopens the file of a file:// client when it has disappeared.
+func (c *Client) reopenIfGone() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.IsTrueFile || c.closed {
+		return nil
+	}
+	if _, err := os.Stat(c.URI.Parts[0]); err != nil {
+		return c.openFile()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestReopen(t *testing.T) {
+	for desc, reopen := range map[string]func(*Client) error{
+		"Reopen":         func(c *Client) error { return c.Reopen() },
+		"derived Reopen": func(c *Client) error { return c.With().Reopen() },
+		"ReopenAll":      func(*Client) error { return ReopenAll() },
+	} {
+		name := filepath.Join(t.TempDir(), "x.log")
+		cl := &Client{
+			URI: &uri.URI{
+				Scheme: uri.File,
+				Parts:  []string{name},
+			},
+		}
+		if err := cl.OpenFile(); err != nil {
+			t.Fatalf("OpenFile() = %v, need nil error", err)
+		}
+		if err := cl.Info("before"); err != nil {
+			t.Fatalf("Info(_) = %v, need nil error", err)
+		}
+		// This is what logrotate does: move the file away, then signal.
+		if err := os.Rename(name, name+".old"); err != nil {
+			t.Fatalf("Rename(_,_) = %v, need nil error", err)
+		}
+		if err := reopen(cl); err != nil {
+			t.Fatalf("%v = %v, need nil error", desc, err)
+		}
+		if err := cl.Info("after"); err != nil {
+			t.Fatalf("Info(_) = %v, need nil error", err)
+		}
+		if got := lines(t, name+".old"); got != 1 {
+			t.Errorf("%v: moved-away file has %v lines, want 1", desc, got)
+		}
+		if got := lines(t, name); got != 1 {
+			t.Errorf("%v: reopened file has %v lines, want 1", desc, got)
+		}
+		cl.Close()
+	}
+}
+
+func TestReopenNonFile(t *testing.T) {
+	// Only true files are reopened, the rest is left alone.
+	if err := DefaultClient.Reopen(); err != nil {
+		t.Errorf("DefaultClient.Reopen() = %v, want nil error", err)
+	}
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// Rotation configures the rotation of file:// clients. Rotated generations of FILENAME are
+// FILENAME.1 (the most recent), FILENAME.2 and so on, with .gz appended when compressed.
+type Rotation struct {
+	Size     int64         // rotate before the file grows beyond this many bytes, 0 = no limit
+	Interval time.Duration // rotate at multiples of this interval (e.g. on the hour), 0 = never
+	Keep     int           // # of rotated generations to keep, at least 1
+	Compress bool          // gzip rotated generations
+}
+
+// RotationFromParams returns the rotation that is stated in the parameters of a file:// URI:
+// rotate-size=SIZE (bytes, or with a suffix K, M or G), rotate-every=DURATION, keep=NR and
+// compress=BOOL. When neither rotate-size nor rotate-every is given, nil is returned.
+func RotationFromParams(params map[string]string) (*Rotation, error) {
+	r := &Rotation{
+		Keep: 1,
+	}
+	var err error
+	if v, ok := params["rotate-size"]; ok {
+		if r.Size, err = uri.ParseSize(v); err != nil {
+			return nil, fmt.Errorf("rotate-size=%v: %v", v, err)
+		}
+	}
+	if v, ok := params["rotate-every"]; ok {
+		if r.Interval, err = time.ParseDuration(v); err != nil || r.Interval <= 0 {
+			return nil, fmt.Errorf("rotate-every=%v: must be a positive duration such as 1h", v)
+		}
+	}
+	if v, ok := params["keep"]; ok {
+		if r.Keep, err = strconv.Atoi(v); err != nil || r.Keep < 1 {
+			return nil, fmt.Errorf("keep=%v: must be a number, 1 or more", v)
+		}
+	}
+	if v, ok := params["compress"]; ok {
+		if r.Compress, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("compress=%v: %v", v, err)
+		}
+	}
+	if r.Size <= 0 && r.Interval <= 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// startRotation is called when a file is (re)opened, so that we know how big it is and when it's
+// due for rotation.
+func (c *Client) startRotation() error {
+	c.written = 0
+	if c.Rotation == nil {
+		return nil
+	}
+	st, err := os.Stat(c.URI.Parts[0])
+	if err != nil {
+		return fmt.Errorf("%v: failed to stat file: %v", c, err)
+	}
+	c.written = st.Size()
+	if c.Rotation.Interval > 0 {
+		c.nextRotation = time.Now().Truncate(c.Rotation.Interval).Add(c.Rotation.Interval)
+	}
+	return nil
+}
+
+// maybeRotate is called before writing n bytes. Lines are never split: a line that doesn't fit
+// goes into the next file.
+func (c *Client) maybeRotate(n int) error {
+	r := c.Rotation
+	if r == nil || !c.IsTrueFile {
+		return nil
+	}
+	due := r.Size > 0 && c.written+int64(n) > r.Size
+	if r.Interval > 0 && !time.Now().Before(c.nextRotation) {
+		due = true
+		c.nextRotation = time.Now().Truncate(r.Interval).Add(r.Interval)
+	}
+	if !due || c.written == 0 {
+		return nil
+	}
+	return c.rotate()
+}
+
+func (c *Client) rotate() error {
+	name := c.URI.Parts[0]
+
+	ext := ""
+	if c.Rotation.Compress {
+		ext = ".gz"
+	}
+	generation := func(i int) string {
+		return fmt.Sprintf("%s.%d%s", name, i, ext)
+	}
+	keep := c.Rotation.Keep
+	if keep < 1 {
+		keep = 1
+	}
+	if err := os.Remove(generation(keep)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%v: failed to remove oldest generation: %v", c, err)
+	}
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(generation(i), generation(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%v: failed to shift generation %v: %v", c, i, err)
+		}
+	}
+	if err := os.Rename(name, name+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%v: failed to rotate: %v", c, err)
+	}
+	if c.Rotation.Compress {
+		if err := gzipFile(name + ".1"); err != nil {
+			return fmt.Errorf("%v: failed to compress: %v", c, err)
+		}
+	}
+	return c.openFile()
+}
+
+// gzipFile replaces name by name.gz. The compressed version only appears when it's complete.
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz.tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(name+".gz.tmp", name+".gz")
+	}
+	if err != nil {
+		os.Remove(name + ".gz.tmp")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestRotationFromParams(t *testing.T) {
+	for _, test := range []struct {
+		params    map[string]string
+		want      *Rotation
+		wantError string
+	}{
+		{
+			// nothing to rotate on
+			params: map[string]string{"keep": "3"},
+			want:   nil,
+		},
+		{
+			params: map[string]string{"rotate-size": "10M", "keep": "3", "compress": "true"},
+			want:   &Rotation{Size: 10 << 20, Keep: 3, Compress: true},
+		},
+		{
+			params: map[string]string{"rotate-size": "512", "rotate-every": "1h"},
+			want:   &Rotation{Size: 512, Interval: time.Hour, Keep: 1},
+		},
+		{
+			params:    map[string]string{"rotate-size": "big"},
+			wantError: "not a valid size",
+		},
+		{
+			params:    map[string]string{"rotate-every": "-1h"},
+			wantError: "rotate-every=-1h",
+		},
+		{
+			params:    map[string]string{"rotate-every": "0s"},
+			wantError: "rotate-every=0s",
+		},
+		{
+			params:    map[string]string{"rotate-size": "1k", "keep": "0"},
+			wantError: "keep=0",
+		},
+		{
+			params:    map[string]string{"rotate-size": "1k", "compress": "maybe"},
+			wantError: "compress=maybe",
+		},
+	} {
+		got, err := RotationFromParams(test.params)
+		switch {
+		case test.wantError != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("RotationFromParams(%v) = _,%v, want error with %q", test.params, err, test.wantError)
+			}
+		case err != nil:
+			t.Errorf("RotationFromParams(%v) = _,%v, want nil error", test.params, err)
+		case (got == nil) != (test.want == nil) || got != nil && *got != *test.want:
+			t.Errorf("RotationFromParams(%v) = %+v, want %+v", test.params, got, test.want)
+		}
+	}
+}
+
+func newRotatingClient(t *testing.T, r *Rotation) (*Client, string) {
+	name := filepath.Join(t.TempDir(), "x.log")
+	cl := &Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{name},
+		},
+		Rotation: r,
+	}
+	if err := cl.OpenFile(); err != nil {
+		t.Fatalf("OpenFile() = %v, need nil error", err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	return cl, name
+}
+
+func lines(t *testing.T, name string) int {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) = _,%v, need nil error", name, err)
+	}
+	return strings.Count(string(b), "\n")
+}
+
+func TestRotateOnSize(t *testing.T) {
+	cl, name := newRotatingClient(t, &Rotation{Size: 100, Keep: 2})
+	line := strings.Repeat("x", 39) + "\n" // 40 bytes, 2 fit into a file
+
+	for i := 0; i < 7; i++ {
+		if err := cl.Passthru([]byte(line)); err != nil {
+			t.Fatalf("Passthru(_) = %v, need nil error", err)
+		}
+	}
+	// 7 lines: x.log.2 has #3 and #4, x.log.1 has #5 and #6, x.log has #7. #1 and #2 are gone.
+	for _, test := range []struct {
+		name      string
+		wantLines int
+	}{
+		{name: name, wantLines: 1},
+		{name: name + ".1", wantLines: 2},
+		{name: name + ".2", wantLines: 2},
+	} {
+		if got := lines(t, test.name); got != test.wantLines {
+			t.Errorf("%v has %v lines, want %v", test.name, got, test.wantLines)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); err == nil {
+		t.Errorf("%v.3 exists, want only 2 generations", name)
+	}
+}
+
+func TestRotateOnTime(t *testing.T) {
+	cl, name := newRotatingClient(t, &Rotation{Interval: time.Hour, Keep: 1, Compress: true})
+	if err := cl.Info("before"); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+	cl.nextRotation = time.Now().Add(-time.Second) // pretend the hour is over
+	if err := cl.Info("after"); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+
+	if got := lines(t, name); got != 1 {
+		t.Errorf("%v has %v lines, want 1", name, got)
+	}
+	f, err := os.Open(name + ".1.gz")
+	if err != nil {
+		t.Fatalf("compressed generation: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(_) = _,%v, need nil error", err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil || !strings.Contains(string(b), "before") {
+		t.Errorf("compressed generation has %q,%v, want the first message", string(b), err)
+	}
+	if !cl.nextRotation.After(time.Now()) {
+		t.Errorf("next rotation at %v, want in the future", cl.nextRotation)
+	}
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+var (
+	DefaultSpoolSize = int64(100 << 20) // max size of a spool when ?spool-size= isn't given
+	SpoolSegments    = 10               // # of segments that a full spool has, the oldest is dropped first
+	SpoolRetry       = 5 * time.Second  // waittime between reconnects while spooling
+)
+
+// minSpoolRetry keeps the background reconnects from spinning when SpoolRetry is zero.
+const minSpoolRetry = time.Second / 100
+
+const spoolExt = ".spool"
+
+// Spool configures the on-disk spool of network clients. While the server can't be reached,
+// messages are appended to segment files in Dir, which are sent in order once the connection is
+// back: the client tries to reconnect every SpoolRetry, also when no messages are sent. When the
+// segments grow beyond MaxSize bytes, the oldest are removed.
+type Spool struct {
+	Dir     string // directory of the segment files, created when needed
+	MaxSize int64  // max # of bytes in all segments, 0 = DefaultSpoolSize
+
+	seg     *os.File // segment that is being appended to
+	segSize int64    // size of seg
+	scanned bool     // true once size and next are known, see scan
+	size    int64    // size of all segments
+	next    int      // number of the next segment
+}
+
+// SpoolFromParams returns the spool that is stated in the parameters of a network URI: spool=DIR
+// and spool-size=SIZE (bytes, or with a suffix K, M or G). When spool is not given, nil is returned.
+func SpoolFromParams(params map[string]string) (*Spool, error) {
+	size := DefaultSpoolSize
+	var err error
+	if v, ok := params["spool-size"]; ok {
+		if size, err = uri.ParseSize(v); err != nil || size < 1 {
+			return nil, fmt.Errorf("spool-size=%v: must be a size, 1 or more", v)
+		}
+	}
+	dir, ok := params["spool"]
+	if !ok {
+		if _, ok := params["spool-size"]; ok {
+			return nil, fmt.Errorf("spool-size=%v: needs spool=DIR", params["spool-size"])
+		}
+		return nil, nil
+	}
+	return &Spool{
+		Dir:     dir,
+		MaxSize: size,
+	}, nil
+}
+
+// segments returns the paths of the segment files, oldest first.
+func (s *Spool) segments() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	nrs := []int{}
+	for _, e := range entries {
+		if nr, err := strconv.Atoi(strings.TrimSuffix(e.Name(), spoolExt)); err == nil && strings.HasSuffix(e.Name(), spoolExt) {
+			nrs = append(nrs, nr)
+		}
+	}
+	sort.Ints(nrs)
+	out := []string{}
+	for _, nr := range nrs {
+		out = append(out, s.segment(nr))
+	}
+	return out, nil
+}
+
+func (s *Spool) segment(nr int) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%010d%v", nr, spoolExt))
+}
+
+// scan determines the size of the spool and the next segment number, e.g. when segments are left
+// over from a previous run.
+func (s *Spool) scan() error {
+	if s.scanned {
+		return nil
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	s.scanned = true
+	s.size = 0
+	for _, seg := range segs {
+		if st, err := os.Stat(seg); err == nil {
+			s.size += st.Size()
+		}
+		nr, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(seg), spoolExt))
+		s.next = nr + 1
+	}
+	return nil
+}
+
+// maxSize returns MaxSize, or DefaultSpoolSize when it isn't set.
+func (s *Spool) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return DefaultSpoolSize
+}
+
+// add appends buf to the spool, and returns the number of segments that were evicted to make room.
+func (s *Spool) add(buf []byte) (int, error) {
+	if err := s.scan(); err != nil {
+		return 0, err
+	}
+	segMax := s.maxSize() / int64(SpoolSegments)
+	if s.seg != nil && s.segSize+int64(len(buf)) > segMax {
+		s.close()
+	}
+	if s.seg == nil {
+		if err := os.MkdirAll(s.Dir, 0755); err != nil {
+			return 0, err
+		}
+		f, err := os.OpenFile(s.segment(s.next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		s.seg, s.segSize = f, 0
+		s.next++
+	}
+	n, err := s.seg.Write(buf)
+	s.segSize += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return s.evict()
+}
+
+// evict removes the oldest segments until the spool fits into MaxSize. The segment that is being
+// appended to is never removed.
+func (s *Spool) evict() (int, error) {
+	if s.size <= s.maxSize() {
+		return 0, nil
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+	evicted := 0
+	for _, seg := range segs {
+		if s.size <= s.maxSize() || (s.seg != nil && seg == s.seg.Name()) {
+			break
+		}
+		st, err := os.Stat(seg)
+		if err != nil {
+			return evicted, err
+		}
+		if err := os.Remove(seg); err != nil {
+			return evicted, err
+		}
+		s.size -= st.Size()
+		evicted++
+	}
+	return evicted, nil
+}
+
+// replay sends the spooled messages to w, one message per write, oldest first. Segments are
+// removed once they are sent. When sending fails, the unsent segments stay; the segment that was
+// being sent is sent again from its start upon the next replay.
+func (s *Spool) replay(w io.Writer) error {
+	s.close()
+	if err := s.scan(); err != nil {
+		return err
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		b, err := ioutil.ReadFile(seg)
+		if err != nil {
+			return err
+		}
+		for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(seg); err != nil {
+			return err
+		}
+		s.size -= int64(len(b))
+	}
+	return nil
+}
+
+// close closes the segment that is being appended to, if any.
+func (s *Spool) close() {
+	if s.seg != nil {
+		s.seg.Close()
+		s.seg = nil
+	}
+}
+
+// spool appends buf to the spool of c.
+func (c *Client) spool(buf []byte) error {
+	evicted, err := c.Spool.add(buf)
+	if evicted > 0 {
+		c.warn("%v: spool %v is full, dropped the %v oldest segment(s)", c, c.Spool.Dir, evicted)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: failed to spool: %v", c, err)
+	}
+	return nil
+}
+
+// reconnectSpooled tries to reconnect a spooling client upon a write, but not more often than
+// SpoolRetry. In between writes, retrySpooled does the same.
+// It returns true when the client is connected again, and the spool is sent.
+func (c *Client) reconnectSpooled() bool {
+	if time.Now().Before(c.nextDial) {
+		return false
+	}
+	c.connect(1)
+	return !c.spooling
+}
+
+// retrySpooled reconnects a spooling client every SpoolRetry, so that the spool is sent once the
+// server is back, even when nothing new is sent. It stops when the client is connected, or when
+// stop is closed by Close().
+func (c *Client) retrySpooled(stop chan struct{}) {
+	for {
+		c.mu.Lock()
+		wait := time.Until(c.nextDial)
+		c.mu.Unlock()
+		if wait < minSpoolRetry {
+			wait = minSpoolRetry
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		if c.spooling && !time.Now().Before(c.nextDial) {
+			c.connect(1)
+		}
+		done := !c.spooling
+		if done {
+			c.retryStop = nil
+		}
+		c.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
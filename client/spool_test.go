@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestSpoolFromParams(t *testing.T) {
+	for _, test := range []struct {
+		params    map[string]string
+		want      *Spool
+		wantError string
+	}{
+		{
+			params: map[string]string{},
+			want:   nil,
+		},
+		{
+			params: map[string]string{"spool": "/tmp/s"},
+			want:   &Spool{Dir: "/tmp/s", MaxSize: DefaultSpoolSize},
+		},
+		{
+			params: map[string]string{"spool": "/tmp/s", "spool-size": "10M"},
+			want:   &Spool{Dir: "/tmp/s", MaxSize: 10 << 20},
+		},
+		{
+			params:    map[string]string{"spool-size": "10M"},
+			wantError: "needs spool=DIR",
+		},
+		{
+			params:    map[string]string{"spool": "/tmp/s", "spool-size": "0"},
+			wantError: "1 or more",
+		},
+	} {
+		got, err := SpoolFromParams(test.params)
+		switch {
+		case test.wantError != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("SpoolFromParams(%v) = _,%v, want error with %q", test.params, err, test.wantError)
+			}
+		case err != nil:
+			t.Errorf("SpoolFromParams(%v) = _,%v, want nil error", test.params, err)
+		case (got == nil) != (test.want == nil):
+			t.Errorf("SpoolFromParams(%v) = %+v, want %+v", test.params, got, test.want)
+		case got != nil && (got.Dir != test.want.Dir || got.MaxSize != test.want.MaxSize):
+			t.Errorf("SpoolFromParams(%v) = %+v, want %+v", test.params, got, test.want)
+		}
+	}
+}
+
+func TestSpoolEviction(t *testing.T) {
+	dir := t.TempDir()
+	s := &Spool{Dir: dir, MaxSize: 100} // segments of 10 bytes, 1 message each
+	evicted := 0
+	for i := 0; i < 30; i++ {
+		n, err := s.add([]byte(fmt.Sprintf("message%02d\n", i)))
+		if err != nil {
+			t.Fatalf("add(_) = _,%v, need nil error", err)
+		}
+		evicted += n
+	}
+	if evicted != 20 {
+		t.Errorf("evicted %v segments, want 20", evicted)
+	}
+
+	// Leftovers are found by a new spool, which continues after them.
+	s.close()
+	s = &Spool{Dir: dir, MaxSize: 100}
+	if _, err := s.add([]byte("leftover\n")); err != nil {
+		t.Fatalf("add(_) = _,%v, need nil error", err)
+	}
+	var buf bytes.Buffer
+	if err := s.replay(&buf); err != nil {
+		t.Fatalf("replay(_) = %v, need nil error", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 || lines[0] != "message21" || lines[8] != "message29" || lines[9] != "leftover" {
+		t.Errorf("replay gives %v, want the newest messages, oldest first", lines)
+	}
+	if segs, _ := s.segments(); len(segs) != 0 {
+		t.Errorf("after replay there are segments %v, want none", segs)
+	}
+
+	// A spool without MaxSize gets the default size.
+	if got := (&Spool{Dir: dir}).maxSize(); got != DefaultSpoolSize {
+		t.Errorf("maxSize() without MaxSize = %v, want %v", got, DefaultSpoolSize)
+	}
+}
+
+// receiver accepts connections on addr and sends the received messages to ch. The returned
+// function stops it, like a crashing server.
+func receiver(t *testing.T, addr string, ch chan string) func() {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("net.Listen(_,%v) = _,%v, need nil error", addr, err)
+	}
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					parts := strings.Split(sc.Text(), " | ")
+					ch <- parts[len(parts)-1]
+				}
+			}()
+		}
+	}()
+	return func() {
+		l.Close()
+		for {
+			select {
+			case conn := <-conns:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	}
+}
+
+// isSpooling returns c.spooling, which the client may change in the background.
+func isSpooling(c *Client) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spooling
+}
+
+func TestSpooling(t *testing.T) {
+	defer func(w, r time.Duration, a int) {
+		RestartWait, SpoolRetry, RestartAttempts = w, r, a
+	}(RestartWait, SpoolRetry, RestartAttempts)
+	RestartWait, SpoolRetry, RestartAttempts = 0, 0, 1
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// The server isn't there yet, so messages get spooled.
+	ur, err := uri.New("tcp://" + addr + "?spool=" + t.TempDir())
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	cl := &Client{URI: ur}
+	if err := cl.ApplyParams(); err != nil {
+		t.Fatalf("ApplyParams() = %v, need nil error", err)
+	}
+	defer cl.Close()
+	if err := cl.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, want nil error while spooling", err)
+	}
+	for _, m := range []string{"one", "two"} {
+		if err := cl.Info(m); err != nil {
+			t.Fatalf("Info(_) = %v, need nil error", err)
+		}
+	}
+
+	// Once the server is there, the spool is sent first.
+	ch := make(chan string, 100)
+	stop := receiver(t, addr, ch)
+	cl.Info("three")
+	want := []string{"one", "two", "three"}
+
+	// When the server goes away, the client starts spooling again.
+	for _, m := range want {
+		if got := <-ch; got != m {
+			t.Fatalf("received %q, want %q", got, m)
+		}
+	}
+	stop()
+	want = nil
+	for i := 0; i < 100 && !isSpooling(cl); i++ {
+		m := fmt.Sprintf("m%v", i)
+		cl.Info(m)
+		if isSpooling(cl) {
+			want = append(want, m) // the message that failed, the ones before may be lost
+		}
+		time.Sleep(time.Second / 100)
+	}
+	if !isSpooling(cl) {
+		t.Fatalf("client doesn't spool after the server went away")
+	}
+	cl.Info("spooled")
+	defer receiver(t, addr, ch)()
+	cl.Info("back")
+	for _, m := range append(want, "spooled", "back") {
+		select {
+		case got := <-ch:
+			if got != m {
+				t.Errorf("received %q, want %q", got, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", m)
+		}
+	}
+}
+
+func TestSpoolRetry(t *testing.T) {
+	defer func(w, r time.Duration, a int) {
+		RestartWait, SpoolRetry, RestartAttempts = w, r, a
+	}(RestartWait, SpoolRetry, RestartAttempts)
+	RestartWait, SpoolRetry, RestartAttempts = 0, time.Second/20, 1
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ur, err := uri.New("tcp://" + addr + "?spool=" + t.TempDir())
+	if err != nil {
+		t.Fatalf("uri.New(_) = _,%v, need nil error", err)
+	}
+	cl := &Client{URI: ur}
+	if err := cl.ApplyParams(); err != nil {
+		t.Fatalf("ApplyParams() = %v, need nil error", err)
+	}
+	defer cl.Close()
+	if err := cl.Connect(); err != nil {
+		t.Fatalf("Connect() = %v, want nil error while spooling", err)
+	}
+	cl.Info("one")
+
+	// Once the server is there, the spool is sent without further messages.
+	ch := make(chan string, 100)
+	defer receiver(t, addr, ch)()
+	select {
+	case got := <-ch:
+		if got != "one" {
+			t.Errorf("received %q, want %q", got, "one")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("spool isn't sent when no messages follow")
+	}
+	if isSpooling(cl) {
+		t.Errorf("client still spools after sending the spool")
+	}
+}
@@ -0,0 +1,56 @@
+// Package syslog provides clients that send to a syslog server: syslog:// (UDP), syslog+tcp://
+// (TCP with octet-counted framing) and syslog+unix:// (a datagram unix socket such as /dev/log).
+package syslog
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/syslog"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func New(ur *uri.URI) (*client.Client, error) {
+	c := &client.Client{
+		URI: ur,
+	}
+	if err := c.ApplyParams(); err != nil {
+		return nil, err
+	}
+	h, err := HeaderFromParams(ur.Params)
+	if err != nil {
+		c.Close() // stops the queue of an async client
+		return nil, fmt.Errorf("%v: %v", c, err)
+	}
+	octetCounted := ur.Scheme == uri.SyslogTCP
+	c.Wrap = func(conn net.Conn) io.Writer {
+		return syslog.NewWriter(conn, h, octetCounted)
+	}
+	if err := c.Connect(); err != nil {
+		c.Close() // stops the queue of an async client
+		return nil, err
+	}
+	return c, nil
+}
+
+// HeaderFromParams returns the header of the sent messages, from the parameters facility=NAME,
+// app=NAME, hostname=NAME and procid=ID. Defaults are facility user, the hostname, the name of the
+// program and its PID.
+func HeaderFromParams(params map[string]string) (*syslog.Header, error) {
+	h := syslog.DefaultHeader()
+	if v, ok := params["facility"]; ok {
+		f, err := syslog.FacilityFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("facility=%v: %v", v, err)
+		}
+		h.Facility = f
+	}
+	for key, dst := range map[string]*string{"app": &h.AppName, "hostname": &h.Hostname, "procid": &h.ProcID} {
+		if v, ok := params[key]; ok {
+			*dst = v
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,143 @@
+package syslog
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/syslog"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// receiver starts a stand-in syslog server for ur and returns a channel of the received messages.
+func receiver(t *testing.T, ur *uri.URI) <-chan string {
+	t.Helper()
+	ch := make(chan string, 10)
+	if ur.Scheme == uri.SyslogTCP {
+		l, err := net.Listen("tcp", ur.Address())
+		if err != nil {
+			t.Fatalf("Listen(%v) = _,%v, need nil error", ur, err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			sc := bufio.NewScanner(conn)
+			sc.Split(syslog.ScanFrames)
+			for sc.Scan() {
+				ch <- sc.Text()
+			}
+		}()
+		return ch
+	}
+	conn, err := net.ListenPacket(ur.Scheme.Network(), ur.Address())
+	if err != nil {
+		t.Fatalf("ListenPacket(%v) = _,%v, need nil error", ur, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			ch <- string(buf[:n])
+		}
+	}()
+	return ch
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = _,%v, need nil error", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestSyslog(t *testing.T) {
+	dir := t.TempDir()
+	for _, s := range []string{
+		"syslog://" + freeAddr(t) + "?app=myapp&facility=local0&procid=7",
+		"syslog+tcp://" + freeAddr(t) + "?app=myapp&facility=local0&procid=7",
+		"syslog+unix://" + filepath.Join(dir, "log") + "?app=myapp&facility=local0&procid=7",
+	} {
+		ur, err := uri.New(s)
+		if err != nil {
+			t.Fatalf("uri.New(%q) = _,%v, need nil error", s, err)
+		}
+		ch := receiver(t, ur)
+		c, err := New(ur)
+		if err != nil {
+			t.Fatalf("New(%v) = _,%v, need nil error", ur, err)
+		}
+		c.Infof("hello %v", "world")
+		c.With(msg.String("user", "karel")).Warn("two\nlines")
+
+		for _, want := range []struct {
+			severity int
+			message  string
+			user     string
+		}{
+			{severity: syslog.Informational, message: "hello world"},
+			{severity: syslog.Warning, message: "two", user: "karel"},
+			{severity: syslog.Warning, message: "lines", user: "karel"},
+		} {
+			var got string
+			select {
+			case got = <-ch:
+			case <-time.After(time.Second):
+				t.Fatalf("%v: no message received, want %q", ur, want.message)
+			}
+			m, err := syslog.Parse([]byte(got))
+			if err != nil {
+				t.Fatalf("%v: syslog.Parse(%q) = _,%v, need nil error", ur, got, err)
+			}
+			if m.Facility != 16 || m.Severity != want.severity || m.AppName != "myapp" || m.ProcID != "7" || m.Message != want.message {
+				t.Errorf("%v: received %+v, want facility 16, severity %v, app myapp, procid 7, message %q", ur, m, want.severity, want.message)
+			}
+			if want.user != "" && !strings.Contains(got, `user="`+want.user+`"`) {
+				t.Errorf("%v: received %q, want user=%q", ur, got, want.user)
+			}
+		}
+		c.Close()
+	}
+}
+
+func TestHeaderFromParams(t *testing.T) {
+	for _, test := range []struct {
+		params    map[string]string
+		want      syslog.Header
+		wantError string
+	}{
+		{
+			params: map[string]string{"facility": "daemon", "hostname": "h", "app": "a", "procid": "1"},
+			want:   syslog.Header{Facility: 3, Hostname: "h", AppName: "a", ProcID: "1"},
+		},
+		{
+			params:    map[string]string{"facility": "nope"},
+			wantError: "facility=nope",
+		},
+	} {
+		got, err := HeaderFromParams(test.params)
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("HeaderFromParams(%v) = _,%v, want error with %q", test.params, err, test.wantError)
+			}
+			continue
+		}
+		if err != nil || *got != test.want {
+			t.Errorf("HeaderFromParams(%v) = %+v,%v, want %+v,nil", test.params, got, err, test.want)
+		}
+	}
+}
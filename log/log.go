@@ -1,34 +1,267 @@
-// Package log is an attempt to provide a drop-in replacement for https://pkg.go.dev/log.
-// Some methods of Golang's `log` package are provided as wrapped replacements. Feel free to add more :)
+// Package log is a drop-in replacement for https://pkg.go.dev/log, which sends to smartlog clients.
+// Print(f|ln) send info messages, Panic(f|ln) send critical messages and panic, Fatal(f|ln) send
+// fatal messages and exit. The package-level functions send to client.DefaultClient, unless
+// SetOutput() is called.
+//
+// Smartlog clients state their own timestamp, so the flags Ldate, Ltime, Lmicroseconds and LUTC
+// have no effect; Lshortfile and Llongfile add caller information (see client.Client.Caller). The
+// prefix is always put before the message, as if Lmsgprefix was set.
 package log
 
 import (
 	"fmt"
-	"strings"
+	"io"
+	"os"
+	"sync"
 
 	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
 )
 
-func Fatal(v ...interface{}) {
-	var m strings.Builder
-	for _, p := range v {
-		fmt.Fprintf(&m, fmt.Sprintf("%v", p))
+// Flags, same as in the standard library.
+const (
+	Ldate         = 1 << iota // no effect, see the package documentation
+	Ltime                     // no effect
+	Lmicroseconds             // no effect
+	Llongfile                 // add caller information
+	Lshortfile                // same
+	LUTC                      // no effect
+	Lmsgprefix                // no effect, the prefix is always put before the message
+	LstdFlags     = Ldate | Ltime
+)
+
+// Logger sends to a smartlog client.
+type Logger struct {
+	mu     sync.Mutex
+	prefix string
+	flag   int
+	cl     *client.Client // nil: client.DefaultClient
+}
+
+var std = &Logger{flag: LstdFlags}
+
+// New returns a logger that writes to out, using a smartlog client of its own.
+func New(out io.Writer, prefix string, flag int) *Logger {
+	return &Logger{
+		prefix: prefix,
+		flag:   flag,
+		cl:     writerClient(out),
 	}
-	client.Fatal(m.String())
 }
 
-func Fatalf(format string, v ...interface{}) {
-	client.Fatalf(format, v...)
+// FromClient returns a logger that sends to a smartlog client, e.g. one from any.New().
+func FromClient(cl *client.Client) *Logger {
+	return &Logger{
+		flag: LstdFlags,
+		cl:   cl,
+	}
 }
 
-func Print(v ...interface{}) {
-	var m strings.Builder
-	for _, p := range v {
-		fmt.Fprintf(&m, fmt.Sprintf("%v", p))
+// Default returns the logger that the package-level functions use.
+func Default() *Logger {
+	return std
+}
+
+// writerClient returns a client that writes to w, like the DefaultClient writes to stdout.
+func writerClient(w io.Writer) *client.Client {
+	return &client.Client{
+		Writer: w,
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"writer"},
+		},
 	}
-	client.Info(m.String())
+}
+
+// client returns the client to send to, and the prefix.
+func (l *Logger) client() (*client.Client, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cl := l.base()
+	if l.flag&(Llongfile|Lshortfile) != 0 && !cl.Caller {
+		cl = cl.With()
+		cl.Caller = true
+	}
+	return cl, l.prefix
+}
+
+// base returns the client of the logger, without the settings of the flags. The caller holds l.mu.
+func (l *Logger) base() *client.Client {
+	if l.cl == nil {
+		return client.DefaultClient
+	}
+	return l.cl
+}
+
+// output sends s on behalf of the caller at calldepth, where 1 is the caller of output.
+func (l *Logger) output(calldepth int, t msg.MsgType, s string) error {
+	cl, prefix := l.client()
+	return cl.Output(calldepth+1, t, prefix+s)
+}
+
+// Output sends s as an info message. calldepth is the number of stack frames to skip for caller
+// information, where 1 is the caller of Output.
+func (l *Logger) Output(calldepth int, s string) error {
+	return l.output(calldepth+1, msg.Info, s)
+}
+
+func (l *Logger) Print(v ...interface{}) {
+	l.output(2, msg.Info, fmt.Sprint(v...))
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(2, msg.Info, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Println(v ...interface{}) {
+	l.output(2, msg.Info, fmt.Sprintln(v...))
+}
+
+func (l *Logger) Panic(v ...interface{}) {
+	s := fmt.Sprint(v...)
+	l.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func (l *Logger) Panicf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	l.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func (l *Logger) Panicln(v ...interface{}) {
+	s := fmt.Sprintln(v...)
+	l.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func (l *Logger) Fatal(v ...interface{}) {
+	l.fatal(fmt.Sprint(v...))
+}
+
+func (l *Logger) Fatalf(format string, v ...interface{}) {
+	l.fatal(fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Fatalln(v ...interface{}) {
+	l.fatal(fmt.Sprintln(v...))
+}
+
+// fatal sends the message on behalf of the caller of Fatal etc., closes all clients and exits.
+func (l *Logger) fatal(s string) {
+	l.output(3, msg.Fatal, s)
+	client.CloseAll()
+	os.Exit(1)
+}
+
+func (l *Logger) Flags() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flag
+}
+
+func (l *Logger) SetFlags(flag int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flag = flag
+}
+
+func (l *Logger) Prefix() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.prefix
+}
+
+func (l *Logger) SetPrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prefix = prefix
+}
+
+// SetOutput makes the logger write to w, using a smartlog client of its own.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cl = writerClient(w)
+}
+
+// Writer returns the writer of the client, which is nil when FromClient() got a client that was
+// derived using With().
+func (l *Logger) Writer() io.Writer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.base().Writer
+}
+
+// The package-level functions use the Default() logger.
+
+func Output(calldepth int, s string) error {
+	return std.output(calldepth+1, msg.Info, s)
+}
+
+func Print(v ...interface{}) {
+	std.output(2, msg.Info, fmt.Sprint(v...))
 }
 
 func Printf(format string, v ...interface{}) {
-	client.Infof(format, v...)
+	std.output(2, msg.Info, fmt.Sprintf(format, v...))
+}
+
+func Println(v ...interface{}) {
+	std.output(2, msg.Info, fmt.Sprintln(v...))
+}
+
+func Panic(v ...interface{}) {
+	s := fmt.Sprint(v...)
+	std.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func Panicf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	std.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func Panicln(v ...interface{}) {
+	s := fmt.Sprintln(v...)
+	std.output(2, msg.Critical, s)
+	panic(s)
+}
+
+func Fatal(v ...interface{}) {
+	std.fatal(fmt.Sprint(v...))
+}
+
+func Fatalf(format string, v ...interface{}) {
+	std.fatal(fmt.Sprintf(format, v...))
+}
+
+func Fatalln(v ...interface{}) {
+	std.fatal(fmt.Sprintln(v...))
+}
+
+func Flags() int {
+	return std.Flags()
+}
+
+func SetFlags(flag int) {
+	std.SetFlags(flag)
+}
+
+func Prefix() string {
+	return std.Prefix()
+}
+
+func SetPrefix(prefix string) {
+	std.SetPrefix(prefix)
+}
+
+func SetOutput(w io.Writer) {
+	std.SetOutput(w)
+}
+
+func Writer() io.Writer {
+	return std.Writer()
 }
@@ -1,7 +1,193 @@
 package log
 
-import "testing"
+import (
+	"bytes"
+	stdlog "log"
+	"runtime"
+	"strings"
+	"testing"
 
-func TestAll(t *testing.T) {
-	// No tests (yet).
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+// stdlibText returns what the standard library logs for f, without timestamp and newline.
+func stdlibText(prefix string, f func(l *stdlog.Logger)) (text string, panicked interface{}) {
+	var buf bytes.Buffer
+	l := stdlog.New(&buf, prefix, 0)
+	func() {
+		defer func() { panicked = recover() }()
+		f(l)
+	}()
+	return strings.TrimSuffix(buf.String(), "\n"), panicked
+}
+
+// smartlogMessage returns the message that a Logger sends for f.
+func smartlogMessage(t *testing.T, prefix string, f func(l *Logger)) (m *msg.Message, panicked interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := New(&buf, prefix, LstdFlags)
+	func() {
+		defer func() { panicked = recover() }()
+		f(l)
+	}()
+	m, err := msg.ParseStrict(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseStrict(%q) = _,%v, need nil error", buf.String(), err)
+	}
+	return m, panicked
+}
+
+func TestLikeStdlib(t *testing.T) {
+	args := []interface{}{"a", 1, 2, "b", 3.5, nil}
+	for _, test := range []struct {
+		desc     string
+		std      func(l *stdlog.Logger)
+		smart    func(l *Logger)
+		wantType msg.MsgType
+	}{
+		{
+			desc:     "Print",
+			std:      func(l *stdlog.Logger) { l.Print(args...) },
+			smart:    func(l *Logger) { l.Print(args...) },
+			wantType: msg.Info,
+		},
+		{
+			desc:     "Printf",
+			std:      func(l *stdlog.Logger) { l.Printf("%v=%d%%", "x", 42) },
+			smart:    func(l *Logger) { l.Printf("%v=%d%%", "x", 42) },
+			wantType: msg.Info,
+		},
+		{
+			desc:     "Println",
+			std:      func(l *stdlog.Logger) { l.Println(args...) },
+			smart:    func(l *Logger) { l.Println(args...) },
+			wantType: msg.Info,
+		},
+		{
+			desc:     "Output",
+			std:      func(l *stdlog.Logger) { l.Output(1, "100%") },
+			smart:    func(l *Logger) { l.Output(1, "100%") },
+			wantType: msg.Info,
+		},
+		{
+			desc:     "Panic",
+			std:      func(l *stdlog.Logger) { l.Panic(args...) },
+			smart:    func(l *Logger) { l.Panic(args...) },
+			wantType: msg.Critical,
+		},
+		{
+			desc:     "Panicf",
+			std:      func(l *stdlog.Logger) { l.Panicf("%v!", "oops") },
+			smart:    func(l *Logger) { l.Panicf("%v!", "oops") },
+			wantType: msg.Critical,
+		},
+		{
+			desc:     "Panicln",
+			std:      func(l *stdlog.Logger) { l.Panicln(args...) },
+			smart:    func(l *Logger) { l.Panicln(args...) },
+			wantType: msg.Critical,
+		},
+	} {
+		for _, prefix := range []string{"", "prefix: "} {
+			wantText, wantPanic := stdlibText(prefix, test.std)
+			m, gotPanic := smartlogMessage(t, prefix, test.smart)
+			if m.Message != wantText || m.Type != test.wantType {
+				t.Errorf("%v with prefix %q sends %v %q, want %v %q", test.desc, prefix, m.Type, m.Message, test.wantType, wantText)
+			}
+			if gotPanic != wantPanic {
+				t.Errorf("%v with prefix %q panics with %#v, want %#v", test.desc, prefix, gotPanic, wantPanic)
+			}
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "p", Lshortfile)
+	if got := l.Prefix(); got != "p" {
+		t.Errorf("Prefix() = %q, want %q", got, "p")
+	}
+	l.SetPrefix("q")
+	if got := l.Prefix(); got != "q" {
+		t.Errorf("Prefix() after SetPrefix(%q) = %q, want %q", "q", got, "q")
+	}
+	if got := l.Flags(); got != Lshortfile {
+		t.Errorf("Flags() = %v, want %v", got, Lshortfile)
+	}
+	l.SetFlags(LstdFlags)
+	if got := l.Flags(); got != LstdFlags {
+		t.Errorf("Flags() after SetFlags(%v) = %v, want %v", LstdFlags, got, LstdFlags)
+	}
+	if got := l.Writer(); got != &buf {
+		t.Errorf("Writer() = %v, want the writer of New()", got)
+	}
+	l.SetFlags(Lshortfile)
+	if got := l.Writer(); got != &buf {
+		t.Errorf("Writer() with flag Lshortfile = %v, want the writer of New()", got)
+	}
+	l.SetFlags(LstdFlags)
+	var other bytes.Buffer
+	l.SetOutput(&other)
+	if got := l.Writer(); got != &other {
+		t.Errorf("Writer() = %v, want the writer of SetOutput()", got)
+	}
+	l.Print("hello")
+	if buf.Len() > 0 || !strings.HasSuffix(other.String(), "| I | qhello\n") {
+		t.Errorf("Print() after SetOutput() wrote %q to the old writer and %q to the new one, want only the new one", buf.String(), other.String())
+	}
+
+	// The Default logger uses client.DefaultClient, until its output is set.
+	if got, want := Writer(), client.DefaultClient.Writer; got != want {
+		t.Errorf("Writer() = %v, want the writer of client.DefaultClient %v", got, want)
+	}
+	defer SetFlags(Flags())
+	SetFlags(Llongfile)
+	if got, want := Writer(), client.DefaultClient.Writer; got != want {
+		t.Errorf("Writer() with flag Llongfile = %v, want the writer of client.DefaultClient %v", got, want)
+	}
+	if Default() != std {
+		t.Errorf("Default() isn't the logger of the package-level functions")
+	}
+}
+
+func TestCaller(t *testing.T) {
+	buf := new(bytes.Buffer)
+	saved := client.DefaultClient
+	defer func() { client.DefaultClient = saved }()
+	client.DefaultClient = &client.Client{
+		URI:    &uri.URI{Scheme: uri.File, Parts: []string{"buffer"}},
+		Writer: buf,
+	}
+	SetFlags(Lshortfile)
+	defer SetFlags(LstdFlags)
+	l := New(buf, "", Llongfile)
+
+	for desc, f := range map[string]func() int{
+		"Print":    func() int { _, _, l, _ := runtime.Caller(0); Print("hello"); return l },
+		"Printf":   func() int { _, _, l, _ := runtime.Caller(0); Printf("hello"); return l },
+		"Println":  func() int { _, _, l, _ := runtime.Caller(0); Println("hello"); return l },
+		"Output":   func() int { _, _, l, _ := runtime.Caller(0); Output(1, "hello"); return l },
+		"l.Print":  func() int { _, _, line, _ := runtime.Caller(0); l.Print("hello"); return line },
+		"l.Output": func() int { _, _, line, _ := runtime.Caller(0); l.Output(1, "hello"); return line },
+	} {
+		buf.Reset()
+		line := f()
+		m, err := msg.ParseStrict(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: ParseStrict(%q) = _,%v, need nil error", desc, buf.String(), err)
+		}
+		if m.Caller == nil || m.Caller.File != "log/log_test.go" || m.Caller.Line != line {
+			t.Errorf("%v: caller = %+v, want log/log_test.go:%v", desc, m.Caller, line)
+		}
+	}
+
+	// Without Lshortfile or Llongfile, there's no caller information.
+	buf.Reset()
+	SetFlags(LstdFlags)
+	Print("hello")
+	if strings.Contains(buf.String(), "@caller") {
+		t.Errorf("Print() without Lshortfile wrote %q, want no caller", buf.String())
+	}
 }
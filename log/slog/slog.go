@@ -0,0 +1,153 @@
+//go:build go1.21
+
+// Package slog provides a handler for https://pkg.go.dev/log/slog that sends to smartlog clients.
+// Attributes become fields of messages; attributes in groups get keys like "group.key".
+package slog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// Handler is a slog.Handler that sends to a smartlog client.
+type Handler struct {
+	cl     *client.Client
+	fields []msg.Field // from WithAttrs
+	prefix string      // from WithGroup, e.g. "group.subgroup."
+}
+
+// NewHandler returns a handler that sends to cl, or to client.DefaultClient when cl is nil. Use it
+// as slog.New(slog.NewHandler(cl)).
+func NewHandler(cl *client.Client) *Handler {
+	return &Handler{cl: cl}
+}
+
+func (h *Handler) client() *client.Client {
+	if h.cl == nil {
+		return client.DefaultClient
+	}
+	return h.cl
+}
+
+// Type returns the message type for a slog level:
+//
+//   - below slog.LevelDebug: msg.Trace,
+//   - from slog.LevelDebug: msg.Debug,
+//   - from slog.LevelInfo: msg.Info, from slog.LevelInfo+2: msg.Notice,
+//   - from slog.LevelWarn: msg.Warn,
+//   - from slog.LevelError: msg.Error, from slog.LevelError+4: msg.Critical.
+//
+// The handler never sends msg.Fatal, since it doesn't exit.
+func Type(level slog.Level) msg.MsgType {
+	switch {
+	case level < slog.LevelDebug:
+		return msg.Trace
+	case level < slog.LevelInfo:
+		return msg.Debug
+	case level < slog.LevelInfo+2:
+		return msg.Info
+	case level < slog.LevelWarn:
+		return msg.Notice
+	case level < slog.LevelError:
+		return msg.Warn
+	case level < slog.LevelError+4:
+		return msg.Error
+	}
+	return msg.Critical
+}
+
+// DebugLevel returns the level that Debug() of a client would get for a slog level below
+// slog.LevelInfo: 1 down to slog.LevelDebug, and one more for every level below that.
+func DebugLevel(level slog.Level) uint8 {
+	lev := int(slog.LevelDebug-level) + 1
+	if lev < 1 {
+		return 1
+	}
+	if lev > 255 {
+		return 255
+	}
+	return uint8(lev)
+}
+
+// Enabled is true for slog.LevelInfo and above. Lower levels are enabled when the DebugThreshold
+// of the client is at least DebugLevel(level).
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	if level >= slog.LevelInfo {
+		return true
+	}
+	return h.client().DebugEnabled(DebugLevel(level))
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]msg.Field, len(h.fields), len(h.fields)+r.NumAttrs())
+	copy(fields, h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+	return h.client().With(fields...).OutputPC(r.PC, Type(r.Level), r.Message)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]msg.Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.prefix, a)
+	}
+	return &Handler{
+		cl:     h.cl,
+		fields: fields,
+		prefix: h.prefix,
+	}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{
+		cl:     h.cl,
+		fields: h.fields,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+// appendAttr appends a as fields, with the keys prefixed. Groups are flattened; empty attributes
+// and empty groups are left out, as slog handlers should.
+func appendAttr(fields []msg.Field, prefix string, a slog.Attr) []msg.Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	key := prefix + a.Key
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, msg.String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, msg.Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, msg.Any(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, msg.Float(key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, msg.Bool(key, v.Bool()))
+	case slog.KindTime:
+		return append(fields, msg.String(key, v.Time().Format(time.RFC3339Nano)))
+	case slog.KindAny:
+		return append(fields, msg.Any(key, v.Any()))
+	}
+	return append(fields, msg.String(key, v.String()))
+}
@@ -0,0 +1,168 @@
+//go:build go1.21
+
+package slog
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func newTestClient(buf *bytes.Buffer) *client.Client {
+	return &client.Client{
+		URI: &uri.URI{
+			Scheme: uri.File,
+			Parts:  []string{"buffer"},
+		},
+		Writer: buf,
+	}
+}
+
+type token string
+
+func (t token) LogValue() slog.Value {
+	return slog.StringValue("REDACTED")
+}
+
+func TestHandler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := newTestClient(buf)
+	l := slog.New(NewHandler(cl))
+	when := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, test := range []struct {
+		desc       string
+		log        func()
+		wantType   msg.MsgType
+		wantText   string
+		wantFields []msg.Field
+	}{
+		{
+			desc:     "plain",
+			log:      func() { l.Info("hello") },
+			wantType: msg.Info,
+			wantText: "hello",
+		},
+		{
+			desc: "typed attributes",
+			log: func() {
+				l.Warn("hello", "s", "x", "i", 42, "u", uint(7), "f", 0.5, "b", true, "d", time.Second, "t", when)
+			},
+			wantType: msg.Warn,
+			wantText: "hello",
+			wantFields: []msg.Field{
+				msg.String("s", "x"), msg.Int("i", 42), msg.Int("u", 7), msg.Float("f", 0.5), msg.Bool("b", true),
+				msg.String("d", "1s"), msg.String("t", "2022-01-02T03:04:05Z"),
+			},
+		},
+		{
+			desc:       "LogValuer",
+			log:        func() { l.Error("hello", "token", token("secret")) },
+			wantType:   msg.Error,
+			wantText:   "hello",
+			wantFields: []msg.Field{msg.String("token", "REDACTED")},
+		},
+		{
+			desc: "groups",
+			log: func() {
+				l.With("a", 1).WithGroup("g").With("b", 2).WithGroup("h").Info("hello",
+					"c", 3, slog.Group("i", "d", 4), slog.Group("", "e", 5), slog.Group("empty"), slog.Attr{})
+			},
+			wantType: msg.Info,
+			wantText: "hello",
+			wantFields: []msg.Field{
+				msg.Int("a", 1), msg.Int("g.b", 2), msg.Int("g.h.c", 3), msg.Int("g.h.i.d", 4), msg.Int("g.h.e", 5),
+			},
+		},
+		{
+			desc:     "higher levels",
+			log:      func() { l.Log(nil, slog.LevelError+4, "hello") },
+			wantType: msg.Critical,
+			wantText: "hello",
+		},
+	} {
+		buf.Reset()
+		test.log()
+		m, err := msg.ParseStrict(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: ParseStrict(%q) = _,%v, need nil error", test.desc, buf.String(), err)
+		}
+		if m.Type != test.wantType || m.Message != test.wantText || !reflect.DeepEqual(m.Fields, test.wantFields) {
+			t.Errorf("%v: sent %v %q %v, want %v %q %v", test.desc, m.Type, m.Message, m.Fields, test.wantType, test.wantText, test.wantFields)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	for level, want := range map[slog.Level]msg.MsgType{
+		slog.LevelDebug - 1: msg.Trace,
+		slog.LevelDebug:     msg.Debug,
+		slog.LevelInfo:      msg.Info,
+		slog.LevelInfo + 2:  msg.Notice,
+		slog.LevelWarn:      msg.Warn,
+		slog.LevelError:     msg.Error,
+		slog.LevelError + 4: msg.Critical,
+	} {
+		if got := Type(level); got != want {
+			t.Errorf("Type(%v) = %v, want %v", level, got, want)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := newTestClient(buf)
+	h := NewHandler(cl)
+	for _, test := range []struct {
+		threshold uint8
+		level     slog.Level
+		want      bool
+	}{
+		{threshold: 0, level: slog.LevelInfo, want: true},
+		{threshold: 0, level: slog.LevelDebug, want: false},
+		{threshold: 1, level: slog.LevelDebug, want: true},
+		{threshold: 1, level: slog.LevelDebug - 1, want: false},
+		{threshold: 2, level: slog.LevelDebug - 1, want: true},
+	} {
+		cl.DebugThreshold = test.threshold
+		if got := h.Enabled(nil, test.level); got != test.want {
+			t.Errorf("threshold %v: Enabled(%v) = %v, want %v", test.threshold, test.level, got, test.want)
+		}
+	}
+
+	// Derived handlers see changes of the threshold.
+	cl.DebugThreshold = 0
+	derived := h.WithAttrs([]slog.Attr{slog.Int("a", 1)}).WithGroup("g")
+	cl.DebugThreshold = 1
+	if !derived.Enabled(nil, slog.LevelDebug) {
+		t.Errorf("derived handler isn't enabled for %v after raising the threshold", slog.LevelDebug)
+	}
+	slog.New(derived).Debug("hello", "b", 2)
+	if want := "| D | hello | a=1 g.b=2\n"; !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+		t.Errorf("Debug() wrote %q, want suffix %q", buf.String(), want)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cl := newTestClient(buf)
+	cl.Caller = true
+	l := slog.New(NewHandler(cl))
+
+	_, _, line, _ := runtime.Caller(0)
+	l.Info("hello")
+	m, err := msg.ParseStrict(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseStrict(%q) = _,%v, need nil error", buf.String(), err)
+	}
+	if m.Caller == nil || m.Caller.File != "slog/slog_test.go" || m.Caller.Line != line+1 {
+		t.Errorf("caller = %+v, want slog/slog_test.go:%v", m.Caller, line+1)
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/KarelKubat/smartlog/client"
 	"github.com/KarelKubat/smartlog/client/any"
-
+	"github.com/KarelKubat/smartlog/msg"
 	"github.com/KarelKubat/smartlog/server"
 )
 
@@ -18,20 +22,75 @@ const (
 This is the Smartlog Server, catcher and forwarder of Smartlog-client generated
 messages; version ` + version + `
 
-Usage: smartlog-server [FLAGS] SERVERADDRESS CLIENT [CLIENT...]
+Usage: smartlog-server [FLAGS] SERVERADDRESS CLIENT[#FILTER] [CLIENT[#FILTER]...]
 Where:
 
   SERVERADDRESS defines what the server listens to and must be in the form:
     udp://HOSTNAME:PORT : (leave out the HOSTNAME to listen to all IPs), or
-    tcp://HOSTNAME:PORT : (again, the HOSTNAME can be left out)
+    tcp://HOSTNAME:PORT : (again, the HOSTNAME can be left out), or
+    unix://PATH         : (stream-oriented unix socket), or
+    unixgram://PATH     : (datagram-oriented unix socket), or
+    tls://HOSTNAME:PORT : (TCP with TLS), which needs parameters:
+      ?cert=PATH        : the server's PEM certificate
+      &key=PATH         : and its key
+      &ca=PATH          : optionally, CA bundle to verify client certificates
+      &verify-client=true : optionally, require client certificates, needs ca
+    syslog://HOSTNAME:PORT      : syslog (RFC 5424 or 3164) over UDP, or
+    syslog+tcp://HOSTNAME:PORT  : syslog over TCP, or
+    syslog+unix://PATH          : syslog over a datagram unix socket
+  IPv6 addresses go between brackets, e.g. tcp://[::1]:2022.
+  optionally followed by ?buffer=NR to queue up to NR messages (default 1024),
+  and for tcp://, unix:// and tls:// by ?ack=true to acknowledge messages to
+  clients that have ?ack=true too. With ?hops=true, the server annotates each
+  message with its hostname, the address of the sender and the time of receipt.
+
+  The server accepts both the text format ("timestamp | T | message") and
+  JSON Lines, even mixed on one connection.
 
   CLIENTS defines where received messages are fanned out to. At least one must
   be given. Use one or more of:
     file://stdout      : dumps to stdout
-    file://FILENAME     : appends to FILENAME
+    file://FILENAME     : appends to FILENAME, optionally add parameters to rotate:
+      ?rotate-size=SIZE : when the file would exceed SIZE bytes (or K, M, G)
+      &rotate-every=DUR : at multiples of DUR, e.g. 24h
+      &keep=NR          : keep NR generations
+      &compress=true    : gzip generations
     tcp://HOSTNAME:PORT : forwards to a next hop over TCP
     udp://HOSTNAME:PORT : forwards to a next hop over UDP
+    unix://PATH         : forwards to a local server over a unix socket
+    unixgram://PATH     : same, but using datagrams
+    tls://HOSTNAME:PORT : forwards to a next hop over TLS, optional parameters:
+      ?ca=PATH          : CA bundle to verify the next hop, default system roots
+      &cert=PATH        : client certificate for mutual authentication
+      &key=PATH         : and its key
+      &servername=NAME  : name to verify, default HOSTNAME
+    syslog://HOSTNAME:PORT     : forwards to a syslog server over UDP, or
+    syslog+tcp://HOSTNAME:PORT : over TCP, or
+    syslog+unix://PATH         : over a datagram unix socket, e.g. /dev/log
+      ?facility=NAME    : optionally, facility, default user
+      &app=NAME         : optionally, APP-NAME, default smartlog-server
+      &hostname=NAME    : optionally, HOSTNAME, default the hostname
+      &procid=ID        : optionally, PROCID, default the PID
     none://WHATEVER     : discards, useful for testing
+  Network clients may have a parameter ?spool=DIR to spool messages to DIR while
+  the next hop is down, and spool-size=SIZE to limit the spool (default 100M).
+  tcp://, unix:// and tls:// clients may have ?ack=true to resend messages that
+  the next hop didn't acknowledge; the next hop must have ?ack=true too.
+  Except for none:// and syslog clients, clients may have a parameter
+  ?format=text or ?format=json
+  (use & instead of ? when there are already parameters).
+
+  FILTER optionally restricts which messages a client gets. It is a
+  comma-separated list of:
+    min=TYPE            : lowest message type to pass, e.g. min=warn
+    max=TYPE            : highest message type to pass
+    host=GLOB           : only messages from a matching host, e.g. host=web*
+    program=GLOB        : same, for the program
+    service=GLOB        : same, for the service
+    match=REGEXP        : only messages matching REGEXP, must be the last one
+  where TYPE is trace, debug, info, notice, warn, error, critical, fatal or
+  unknown. Example:
+    tcp://pager-host:2022#min=warn file:///var/log/all.log
 
   FLAGS may be:
 `
@@ -47,6 +106,8 @@ func main() {
 func run() error {
 	// Supported flag(s)
 	flagS := flag.Duration("s", 0, "stop server after stated duration, 0 = serve forever")
+	flagF := flag.String("f", "text", "format in which messages are fanned out to clients without ?format=")
+	flagH := flag.Bool("hup", false, "reopen file clients upon SIGHUP, e.g. after logrotate moved them")
 
 	// Parse options, show usage when that fails.
 	flag.Usage = usageFunc
@@ -57,6 +118,11 @@ func run() error {
 		return errors.New("(not enough arguments)")
 	}
 
+	format, err := msg.FormatFromString(*flagF)
+	if err != nil {
+		return err
+	}
+
 	// Start serving
 	srv, err := server.New(flag.Arg(0))
 	if err != nil {
@@ -69,17 +135,67 @@ func run() error {
 		}()
 	}
 
+	if *flagH {
+		reopenOnSignal()
+	}
+	closeOnSignal(srv)
+
 	// Add clients from the commandline
-	for _, uri := range flag.Args()[1:] {
+	for _, arg := range flag.Args()[1:] {
+		uri, filter, err := clientAndFilter(arg)
+		if err != nil {
+			return err
+		}
 		cl, err := any.New(uri)
 		if err != nil {
 			return err
 		}
-		srv.AddClient(cl)
+		if _, ok := cl.URI.Params["format"]; !ok {
+			cl.Format = format
+		}
+		srv.AddClientWithFilter(cl, filter)
 	}
 	return srv.Serve()
 }
 
+// reopenOnSignal starts a goroutine that reopens all file:// clients upon SIGHUP.
+func reopenOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := client.ReopenAll(); err != nil {
+				client.Warnf("SIGHUP: %v", err)
+			}
+		}
+	}()
+}
+
+// closeOnSignal starts a goroutine that closes the server upon SIGINT or SIGTERM. The server
+// first fans out the messages that it still has buffered, then closes the clients so that their
+// queued messages get written, and then Serve() returns.
+func closeOnSignal(srv *server.Server) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ch
+		srv.Close()
+	}()
+}
+
+// clientAndFilter splits CLIENT#FILTER into the client URI and the parsed filter.
+func clientAndFilter(arg string) (string, *server.Filter, error) {
+	parts := strings.SplitN(arg, "#", 2)
+	if len(parts) == 1 {
+		return arg, nil, nil
+	}
+	f, err := server.ParseFilter(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: %v", arg, err)
+	}
+	return parts[0], f, nil
+}
+
 func usageFunc() {
 	fmt.Fprintf(os.Stderr, usage)
 	flag.PrintDefaults()
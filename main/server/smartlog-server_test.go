@@ -25,3 +25,41 @@ func TestArgs(t *testing.T) {
 		t.Errorf("run() with args %v = %v, want something with '%v'", os.Args, err, errTag)
 	}
 }
+
+func TestClientAndFilter(t *testing.T) {
+	for _, test := range []struct {
+		arg        string
+		wantURI    string
+		wantFilter string
+		wantError  bool
+	}{
+		{
+			arg:        "file:///var/log/all.log",
+			wantURI:    "file:///var/log/all.log",
+			wantFilter: "all",
+		},
+		{
+			arg:        "tcp://pager-host:2022#min=warn",
+			wantURI:    "tcp://pager-host:2022",
+			wantFilter: "min=warn,max=unknown",
+		},
+		{
+			arg:        "file://stdout#match=a#b",
+			wantURI:    "file://stdout",
+			wantFilter: "min=trace,max=unknown,match=a#b",
+		},
+		{
+			arg:       "file://stdout#min=loud",
+			wantError: true,
+		},
+	} {
+		uri, filter, err := clientAndFilter(test.arg)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("clientAndFilter(%q) = _,_,%v, want error: %v", test.arg, err, test.wantError)
+			continue
+		}
+		if !test.wantError && (uri != test.wantURI || filter.String() != test.wantFilter) {
+			t.Errorf("clientAndFilter(%q) = %q,%v,nil, want %q,%v,nil", test.arg, uri, filter, test.wantURI, test.wantFilter)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package msg
+
+const (
+	DropTracePct = 25 // drop Trace messages from a queue that is over 25% full
+	DropDebugPct = 50 // drop Debug messages from a queue that is over 50% full
+	DropInfoPct  = 75 // drop Info messages from a queue that is over 75% full
+)
+
+// Droppable is true when a message of type t may be dropped from a queue that has used out of
+// capacity slots taken. Only Trace, Debug and Info messages are dropped, more important ones never
+// are.
+func Droppable(t MsgType, used, capacity int) bool {
+	switch t {
+	case Trace:
+		return used > capacity*DropTracePct/100
+	case Debug:
+		return used > capacity*DropDebugPct/100
+	case Info:
+		return used > capacity*DropInfoPct/100
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package msg
+
+import "testing"
+
+func TestDroppable(t *testing.T) {
+	for _, test := range []struct {
+		t    MsgType
+		used int
+		want bool
+	}{
+		{t: Trace, used: 25, want: false},
+		{t: Trace, used: 26, want: true},
+		{t: Debug, used: 50, want: false},
+		{t: Debug, used: 51, want: true},
+		{t: Info, used: 51, want: false},
+		{t: Info, used: 75, want: false},
+		{t: Info, used: 76, want: true},
+		{t: Notice, used: 100, want: false},
+		{t: Warn, used: 100, want: false},
+		{t: Error, used: 100, want: false},
+		{t: Critical, used: 100, want: false},
+		{t: Fatal, used: 100, want: false},
+		{t: Unknown, used: 100, want: false},
+	} {
+		if got := Droppable(test.t, test.used, 100); got != test.want {
+			t.Errorf("Droppable(%v,%v,100) = %v, want %v", test.t, test.used, got, test.want)
+		}
+	}
+}
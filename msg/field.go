@@ -0,0 +1,154 @@
+package msg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Field is a typed key/value pair that travels with a message. Values are one of string, int64,
+// float64 or bool; use the constructors below to get them right.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Any converts value to the closest supported type. Integers become int64 (unsigned ones above
+// math.MaxInt64 become strings), floats become float64, anything else that isn't a string or bool is stringified.
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string, int64, float64, bool:
+		return Field{Key: key, Value: v}
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case uint8:
+		return Int64(key, int64(v))
+	case uint16:
+		return Int64(key, int64(v))
+	case uint32:
+		return Int64(key, int64(v))
+	case uint:
+		return unsigned(key, uint64(v))
+	case uint64:
+		return unsigned(key, v)
+	case uintptr:
+		return unsigned(key, uint64(v))
+	case float32:
+		return Float(key, float64(v))
+	case error:
+		return String(key, v.Error())
+	case fmt.Stringer:
+		return String(key, v.String())
+	}
+	return String(key, fmt.Sprintf("%v", value))
+}
+
+// unsigned returns an int64 field when value fits, or else a string field.
+func unsigned(key string, value uint64) Field {
+	if value <= math.MaxInt64 {
+		return Int64(key, int64(value))
+	}
+	return String(key, strconv.FormatUint(value, 10))
+}
+
+// fieldsToText renders fields as space-separated key=value pairs. Strings are quoted when they
+// contain anything that would confuse reparsing, or when they look like another type.
+func fieldsToText(fields []Field) string {
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(space)
+		}
+		b.WriteString(fieldKey(f.Key))
+		b.WriteByte('=')
+		b.WriteString(fieldValue(f.Value))
+	}
+	return b.String()
+}
+
+func fieldKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	if strings.HasPrefix(key, metaPrefix) {
+		key = "_" + key[len(metaPrefix):] // reserved for metadata
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= space || r == '=' || r == '"' || r == separator {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func fieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if needsQuoting(v) {
+			// A quoted " | " mustn't pass for a separator, so its pipe is escaped.
+			return strings.ReplaceAll(strconv.Quote(v), " | ", ` \x7c `)
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEIN") {
+			s += ".0" // keep 3.0 a float when reparsing
+		}
+		return s
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fieldValue(Any("", value).Value)
+}
+
+// ValueString returns the value of a field as plain text, for formats that do their own quoting.
+func ValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fieldValue(value)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" || s == "true" || s == "false" {
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	for _, r := range s {
+		if r <= space || r == '=' || r == '"' || r == separator || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
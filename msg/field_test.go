@@ -0,0 +1,86 @@
+package msg
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAny(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{value: "hello", want: "hello"},
+		{value: 42, want: int64(42)},
+		{value: uint8(7), want: int64(7)},
+		{value: uint(5), want: int64(5)},
+		{value: uint64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{value: uint64(math.MaxUint64), want: "18446744073709551615"},
+		{value: uintptr(9), want: int64(9)},
+		{value: float32(0.5), want: float64(0.5)},
+		{value: true, want: true},
+		{value: errors.New("oops"), want: "oops"},
+		{value: time.Second, want: "1s"},
+		{value: []int{1, 2}, want: "[1 2]"},
+	} {
+		if got := Any("k", test.value).Value; got != test.want {
+			t.Errorf("Any(_,%#v).Value = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestFieldsToText(t *testing.T) {
+	for _, test := range []struct {
+		fields []Field
+		want   string
+	}{
+		{
+			// plain values
+			fields: []Field{String("req", "abc"), Int("user", 42), Bool("ok", true), Float("f", 0.25)},
+			want:   `req=abc user=42 ok=true f=0.25`,
+		},
+		{
+			// strings that need quoting
+			fields: []Field{String("a", "hello world"), String("b", ""), String("c", `x"y`), String("d", "a|b")},
+			want:   `a="hello world" b="" c="x\"y" d="a|b"`,
+		},
+		{
+			// strings that look like other types are quoted, floats stay floats
+			fields: []Field{String("n", "42"), String("t", "true"), Float("f", 3)},
+			want:   `n="42" t="true" f=3.0`,
+		},
+		{
+			// unsigned integers are numbers, unless they don't fit
+			fields: []Field{Any("n", uint(5)), Any("m", uint64(math.MaxUint64))},
+			want:   `n=5 m="18446744073709551615"`,
+		},
+		{
+			// keys are sanitized
+			fields: []Field{String("", "x"), String("a b=c", "y"), String("@caller", "z")},
+			want:   `_=x a_b_c=y _caller=z`,
+		},
+	} {
+		if got := fieldsToText(test.fields); got != test.want {
+			t.Errorf("fieldsToText(%v) = %q, want %q", test.fields, got, test.want)
+		}
+	}
+}
+
+func TestValueString(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{value: "a b", want: "a b"},
+		{value: "42", want: "42"},
+		{value: int64(42), want: "42"},
+		{value: 3.0, want: "3.0"},
+		{value: true, want: "true"},
+	} {
+		if got := ValueString(test.value); got != test.want {
+			t.Errorf("ValueString(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package msg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format is the wire and output format of messages.
+type Format int
+
+const (
+	Text Format = iota // "timestamp | T | message | fields", one line per line of the message
+	JSON               // JSON Lines, one object per message
+)
+
+var nameForFormat = map[Format]string{
+	Text: "text",
+	JSON: "json",
+}
+
+func (f Format) String() string {
+	return nameForFormat[f]
+}
+
+// FormatFromString is the reverse of Format.String.
+func FormatFromString(s string) (Format, error) {
+	for f, name := range nameForFormat {
+		if name == s {
+			return f, nil
+		}
+	}
+	return Text, fmt.Errorf("unsupported format %q, supported: text, json", s)
+}
+
+// FormatFromBytes sniffs the format of an encoded line.
+func FormatFromBytes(buf []byte) Format {
+	if trimmed := bytes.TrimLeft(buf, " \t"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return JSON
+	}
+	return Text
+}
+
+// Convert re-encodes a line that was produced by BytesFromMessage into the stated format. Lines
+// that are already in that format are returned as-is. Converting may lead to more than one line,
+// e.g. a multi-line JSON message becomes several text lines.
+func Convert(buf []byte, f Format) [][]byte {
+	if FormatFromBytes(buf) == f {
+		return [][]byte{buf}
+	}
+	m, _ := Parse(buf)
+	m.Format = f
+	return BytesFromMessage(m)
+}
+
+func parseText(buf []byte, strict bool) (*Message, error) {
+	line := strings.TrimRight(string(buf), "\r\n")
+	sep := string([]byte{space, separator, space})
+	parts := strings.Split(line, sep)
+	if len(parts) < 3 || len(parts[1]) != 1 {
+		if strict {
+			return nil, fmt.Errorf("%q: expected timestamp | T | message", line)
+		}
+		return &Message{
+			Type:    Unknown,
+			Message: line,
+		}, nil
+	}
+	tp, ok := typeForTag[parts[1][0]]
+	if !ok {
+		if strict {
+			return nil, fmt.Errorf("%q: unknown type tag %q", line, parts[1])
+		}
+		tp = Unknown
+	}
+	m := &Message{
+		Type:      tp,
+		Timestamp: []byte(parts[0]),
+	}
+	rest := parts[2:]
+	if len(rest) > 1 {
+		if fields, err := fieldsFromText(rest[len(rest)-1]); err == nil {
+			m.Fields = metaFromFields(m, fields)
+			rest = rest[:len(rest)-1]
+		}
+	}
+	m.Message = unescapeText(strings.Join(rest, sep))
+	return m, nil
+}
+
+// escapeText escapes separators in a message text, so that the text can't be mistaken for the
+// fields: " | " becomes " \| ", an existing " \| " becomes " \\| ", and so on.
+func escapeText(s string) string {
+	if strings.IndexByte(s, separator) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if _, ok := separatorAt(s, i); ok {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// unescapeText is the reverse of escapeText.
+func unescapeText(s string) string {
+	if !strings.Contains(s, "\\|") {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if backslashes, ok := separatorAt(s, i); ok && backslashes > 0 {
+			out = out[:len(out)-1]
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// separatorAt returns true when s[i] is the pipe of a separator, optionally escaped: a space, zero
+// or more backslashes, a pipe and a space. The end of s counts as a space, since a separator may
+// follow. The number of backslashes is returned too.
+func separatorAt(s string, i int) (int, bool) {
+	if s[i] != separator || (i+1 < len(s) && s[i+1] != space) {
+		return 0, false
+	}
+	j := i - 1
+	for j >= 0 && s[j] == '\\' {
+		j--
+	}
+	if j < 0 || s[j] != space {
+		return 0, false
+	}
+	return i - 1 - j, true
+}
+
+// fieldsFromText is the reverse of fieldsToText. It fails unless all of s is a list of key=value
+// pairs, so that message texts aren't mistaken for fields.
+func fieldsFromText(s string) ([]Field, error) {
+	if s == "" {
+		return nil, errors.New("no fields")
+	}
+	var fields []Field
+	for {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \"|") {
+			return nil, fmt.Errorf("%q: expected key=value", s)
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value interface{}
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("%q: bad quoted value for %q: %v", s, key, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+		} else {
+			end := strings.IndexByte(s, space)
+			if end < 0 {
+				end = len(s)
+			}
+			raw := s[:end]
+			if raw == "" || strings.ContainsAny(raw, "=\"") {
+				return nil, fmt.Errorf("%q: bad value for %q", s, key)
+			}
+			value = typedValue(raw)
+			s = s[end:]
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+
+		if s == "" {
+			return fields, nil
+		}
+		if s[0] != space || len(s) == 1 {
+			return nil, fmt.Errorf("%q: expected a space between fields", s)
+		}
+		s = s[1:]
+	}
+}
+
+// typedValue is the reverse of fieldValue for unquoted values.
+func typedValue(raw string) interface{} {
+	if b, err := strconv.ParseBool(raw); err == nil && (raw == "true" || raw == "false") {
+		return b
+	}
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
@@ -0,0 +1,112 @@
+package msg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatFromString(t *testing.T) {
+	for f := Text; f <= JSON; f++ {
+		got, err := FormatFromString(f.String())
+		if err != nil || got != f {
+			t.Errorf("FormatFromString(%q) = %v,%v, want %v,nil", f.String(), got, err, f)
+		}
+	}
+	if _, err := FormatFromString("xml"); err == nil {
+		t.Error("FormatFromString(\"xml\") = _,nil, want error")
+	}
+}
+
+func TestFormatFromBytes(t *testing.T) {
+	for _, test := range []struct {
+		buf  string
+		want Format
+	}{
+		{buf: "now | I | hello\n", want: Text},
+		{buf: `{"timestamp":"now","level":"info","message":"hello"}` + "\n", want: JSON},
+		{buf: "", want: Text},
+	} {
+		if got := FormatFromBytes([]byte(test.buf)); got != test.want {
+			t.Errorf("FormatFromBytes(%q) = %v, want %v", test.buf, got, test.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, test := range []struct {
+		buf    string
+		format Format
+		want   []string
+	}{
+		{
+			// same format: untouched
+			buf:    "now | I | hello\n",
+			format: Text,
+			want:   []string{"now | I | hello\n"},
+		},
+		{
+			// text to JSON, with fields and a message containing the separator
+			buf:    "now | W | a | b | user=42 req=\"x y\"\n",
+			format: JSON,
+			want:   []string{`{"timestamp":"now","level":"warn","message":"a | b","fields":{"user":42,"req":"x y"}}` + "\n"},
+		},
+		{
+			// JSON to text: multiline becomes multiple lines
+			buf:    `{"timestamp":"now","level":"debug","message":"a\nb","fields":{"f":0.5}}` + "\n",
+			format: Text,
+			want:   []string{"now | D | a | f=0.5\n", "now | D | b | f=0.5\n"},
+		},
+		{
+			// unparseable text isn't lost
+			buf:    "garbage\n",
+			format: JSON,
+			want:   nil, // checked below, has a fresh timestamp
+		},
+	} {
+		got := Convert([]byte(test.buf), test.format)
+		if test.want == nil {
+			if len(got) != 1 || TypeFromBytes(got[0]) != Unknown || parsedText(got[0]) != "garbage" {
+				t.Errorf("Convert(%q,%v) = %q, want an unknown message with the text", test.buf, test.format, got)
+			}
+			continue
+		}
+		gotStrings := []string{}
+		for _, g := range got {
+			gotStrings = append(gotStrings, string(g))
+		}
+		if !reflect.DeepEqual(gotStrings, test.want) {
+			t.Errorf("Convert(%q,%v) = %q, want %q", test.buf, test.format, gotStrings, test.want)
+		}
+	}
+}
+
+func TestFieldsFromText(t *testing.T) {
+	for _, test := range []struct {
+		s         string
+		want      []Field
+		wantError bool
+	}{
+		{
+			s:    `a=1 b=0.5 c=true d=hello e="x y" f="42"`,
+			want: []Field{Int("a", 1), Float("b", 0.5), Bool("c", true), String("d", "hello"), String("e", "x y"), String("f", "42")},
+		},
+		{s: "", wantError: true},
+		{s: "just some text", wantError: true},
+		{s: "a=1 and more", wantError: true},
+		{s: "a=1 ", wantError: true},
+		{s: `a="unterminated`, wantError: true},
+	} {
+		got, err := fieldsFromText(test.s)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("fieldsFromText(%q) = _,%v, want error: %v", test.s, err, test.wantError)
+		}
+		if !test.wantError && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("fieldsFromText(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func parsedText(buf []byte) string {
+	m, _ := Parse(buf)
+	return m.Message
+}
@@ -0,0 +1,173 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// jsonMessage is the JSON Lines representation of a Message.
+type jsonMessage struct {
+	Timestamp string     `json:"timestamp"`
+	Level     string     `json:"level"`
+	Message   string     `json:"message"`
+	Origin    *Origin    `json:"origin,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Caller    *Caller    `json:"caller,omitempty"`
+	Hops      []Hop      `json:"hops,omitempty"`
+	Fields    jsonFields `json:"fields,omitempty"`
+}
+
+// jsonFields is a JSON object that keeps the order of the fields.
+type jsonFields []Field
+
+func jsonFromMessage(m *Message, timestamp []byte) [][]byte {
+	// Empty lines are skipped, just like in the text format.
+	lines := []string{}
+	for _, line := range strings.Split(m.Message, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return [][]byte{}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(&jsonMessage{
+		Timestamp: string(timestamp),
+		Level:     m.Type.String(),
+		Message:   strings.Join(lines, "\n"),
+		Origin:    m.Origin,
+		Name:      m.Name,
+		Caller:    m.Caller,
+		Hops:      m.Hops,
+		Fields:    m.Fields,
+	}); err != nil {
+		// Can't happen: all fields are plain types. But don't lose the message if it does.
+		return [][]byte{[]byte(fmt.Sprintf("{\"level\":\"unknown\",\"message\":%s}\n",
+			jsonString(fmt.Sprintf("failed to encode: %v", err))))}
+	}
+	return [][]byte{buf.Bytes()}
+}
+
+func parseJSON(buf []byte, strict bool) (*Message, error) {
+	var jm jsonMessage
+	err := json.Unmarshal(buf, &jm)
+	if err == nil && TypeFromString(jm.Level) == Unknown && jm.Level != nameForType[Unknown] {
+		err = fmt.Errorf("unknown level %q", jm.Level)
+	}
+	if err != nil {
+		if strict {
+			return nil, fmt.Errorf("%q: %v", strings.TrimRight(string(buf), "\r\n"), err)
+		}
+		return &Message{
+			Type:    Unknown,
+			Format:  JSON,
+			Message: strings.TrimRight(string(buf), "\r\n"),
+		}, nil
+	}
+	return &Message{
+		Type:      TypeFromString(jm.Level),
+		Format:    JSON,
+		Timestamp: []byte(jm.Timestamp),
+		Message:   jm.Message,
+		Origin:    jm.Origin,
+		Name:      jm.Name,
+		Caller:    jm.Caller,
+		Hops:      jm.Hops,
+		Fields:    jm.Fields,
+	}, nil
+}
+
+func typeFromJSON(buf []byte) MsgType {
+	var jm struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(buf, &jm); err != nil {
+		return Unknown
+	}
+	return TypeFromString(jm.Level)
+}
+
+func (fs jsonFields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(jsonString(f.Key))
+		b.WriteByte(':')
+		switch v := Any(f.Key, f.Value).Value.(type) {
+		case string:
+			b.Write(jsonString(v))
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				// Not representable as a JSON number
+				b.Write(jsonString(fieldValue(v)))
+			} else {
+				b.WriteString(fieldValue(v))
+			}
+		default:
+			b.WriteString(fieldValue(v))
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (fs *jsonFields) UnmarshalJSON(buf []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("fields: expected a JSON object, got %s", buf)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		var raw interface{}
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		switch v := raw.(type) {
+		case nil:
+			continue
+		case string, bool:
+			*fs = append(*fs, Field{Key: key, Value: v})
+		case json.Number:
+			if !strings.ContainsAny(v.String(), ".eE") {
+				if i, err := v.Int64(); err == nil {
+					*fs = append(*fs, Int64(key, i))
+					continue
+				}
+			}
+			f, err := v.Float64()
+			if err != nil {
+				return fmt.Errorf("fields: bad number for %q: %v", key, err)
+			}
+			*fs = append(*fs, Float(key, f))
+		default:
+			// Objects and arrays aren't supported as values, keep them as their JSON text.
+			nested, _ := json.Marshal(v)
+			*fs = append(*fs, String(key, string(nested)))
+		}
+	}
+	return nil
+}
+
+// jsonString encodes s as a JSON string without HTML escaping.
+func jsonString(s string) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
@@ -0,0 +1,61 @@
+package msg
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestJSONRoundtrip(t *testing.T) {
+	m := &Message{
+		Type:      Warn,
+		Format:    JSON,
+		Timestamp: []byte("now"),
+		Message:   "\nhello <world>\n\nbye\n",
+		Fields: []Field{
+			String("s", "x y"),
+			Int("i", -3),
+			Float("f", 3),
+			Bool("b", false),
+			Float("nan", math.NaN()),
+		},
+	}
+	b := BytesFromMessage(m)
+	if len(b) != 1 {
+		t.Fatalf("BytesFromMessage(JSON message) = %v lines, want 1", len(b))
+	}
+	want := `{"timestamp":"now","level":"warn","message":"hello <world>\nbye",` +
+		`"fields":{"s":"x y","i":-3,"f":3.0,"b":false,"nan":"NaN"}}` + "\n"
+	if string(b[0]) != want {
+		t.Errorf("BytesFromMessage(JSON message) = %q, want %q", string(b[0]), want)
+	}
+	if tp := TypeFromBytes(b[0]); tp != Warn {
+		t.Errorf("TypeFromBytes(%q) = %v, want %v", string(b[0]), tp, Warn)
+	}
+
+	got, err := parseJSON(b[0], false)
+	if err != nil {
+		t.Fatalf("parseJSON(%q) = _,%v, want nil error", string(b[0]), err)
+	}
+	wantFields := []Field{String("s", "x y"), Int("i", -3), Float("f", 3), Bool("b", false), String("nan", "NaN")}
+	if got.Type != Warn || string(got.Timestamp) != "now" || got.Message != "hello <world>\nbye" ||
+		!reflect.DeepEqual(got.Fields, wantFields) {
+		t.Errorf("parseJSON(%q) = %+v, doesn't match", string(b[0]), got)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	for _, buf := range []string{
+		`{"broken`,
+		`{"some":"other json"}`,
+		`{"level":"loud","message":"hi"}`,
+	} {
+		got, err := parseJSON([]byte(buf), false)
+		if err != nil || got.Type != Unknown || got.Message != buf {
+			t.Errorf("parseJSON(%q,false) = %+v,%v, want unknown message with the input", buf, got, err)
+		}
+		if _, err := parseJSON([]byte(buf), true); err == nil {
+			t.Errorf("parseJSON(%q,true) = _,nil, want error", buf)
+		}
+	}
+}
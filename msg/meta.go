@@ -0,0 +1,184 @@
+package msg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaPrefix starts the keys of metadata in the text format, as in "@caller=main/main.go:12".
+// Keys of fields can't start with it, see fieldKey.
+const metaPrefix = "@"
+
+// Origin is the host and the process that emitted a message.
+type Origin struct {
+	Host    string `json:"host,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	Program string `json:"program,omitempty"` // name of the program, without directory
+	Service string `json:"service,omitempty"` // optional, set by the program
+}
+
+// NewOrigin returns the Origin of the running program, with an optional service name.
+func NewOrigin(service string) *Origin {
+	host, _ := os.Hostname()
+	return &Origin{
+		Host:    host,
+		PID:     os.Getpid(),
+		Program: filepath.Base(os.Args[0]),
+		Service: service,
+	}
+}
+
+// Hop is a smartlog server that received a message.
+type Hop struct {
+	Server   string    `json:"server"`         // hostname of the server
+	Peer     string    `json:"peer,omitempty"` // address of the sender, empty when unknown
+	Received time.Time `json:"received"`       // when the server received the message
+}
+
+// hopTimeFormat is the format of Hop.Received in the text format.
+const hopTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// String returns the hop as "RECEIVED PEER SERVER", where an unknown peer is "-".
+func (h Hop) String() string {
+	peer := h.Peer
+	if peer == "" {
+		peer = "-"
+	}
+	return h.Received.Format(hopTimeFormat) + " " + peer + " " + h.Server
+}
+
+// hopFromString is the reverse of Hop.String.
+func hopFromString(s string) (Hop, bool) {
+	parts := strings.Split(s, " ")
+	if len(parts) != 3 {
+		return Hop{}, false
+	}
+	t, err := time.Parse(hopTimeFormat, parts[0])
+	if err != nil {
+		return Hop{}, false
+	}
+	if parts[1] == "-" {
+		parts[1] = ""
+	}
+	return Hop{Server: parts[2], Peer: parts[1], Received: t}, true
+}
+
+// Caller is where in the source a message was emitted.
+type Caller struct {
+	File     string `json:"file"`               // the file and its directory, e.g. "main/main.go"
+	Line     int    `json:"line"`               // line number in File
+	Function string `json:"function,omitempty"` // the function and its package, e.g. "main.main"
+}
+
+func (c *Caller) String() string {
+	return fmt.Sprintf("%v:%v", c.File, c.Line)
+}
+
+// NewCaller returns a Caller from what runtime.Caller() and runtime.FuncForPC() report: the file
+// and the function are shortened to their last directory and package.
+func NewCaller(file string, line int, function string) *Caller {
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		if j := strings.LastIndexByte(file[:i], '/'); j >= 0 {
+			file = file[j+1:]
+		}
+	}
+	if i := strings.LastIndexByte(function, '/'); i >= 0 {
+		function = function[i+1:]
+	}
+	return &Caller{
+		File:     file,
+		Line:     line,
+		Function: function,
+	}
+}
+
+// metaToText renders the metadata of m as key=value pairs with reserved keys, for the text format.
+func metaToText(m *Message) string {
+	var parts []string
+	if o := m.Origin; o != nil {
+		for _, f := range []Field{String("host", o.Host), Int("pid", o.PID), String("program", o.Program), String("service", o.Service)} {
+			if f.Value != "" && f.Value != int64(0) {
+				parts = append(parts, metaPrefix+f.Key+"="+fieldValue(f.Value))
+			}
+		}
+	}
+	if m.Name != "" {
+		parts = append(parts, metaPrefix+"name="+fieldValue(m.Name))
+	}
+	if m.Caller != nil {
+		parts = append(parts, metaPrefix+"caller="+fieldValue(m.Caller.String()))
+		if m.Caller.Function != "" {
+			parts = append(parts, metaPrefix+"function="+fieldValue(m.Caller.Function))
+		}
+	}
+	for _, h := range m.Hops {
+		parts = append(parts, metaPrefix+"hop="+fieldValue(h.String()))
+	}
+	return strings.Join(parts, string(space))
+}
+
+// metaFromFields is the reverse of metaToText: it sets the metadata of m from fields with
+// reserved keys, and returns the other fields. Unsupported reserved keys are kept as fields.
+func metaFromFields(m *Message, fields []Field) []Field {
+	var rest []Field
+	for _, f := range fields {
+		s, _ := f.Value.(string)
+		if f.Key == metaPrefix+"pid" {
+			pid, ok := f.Value.(int64)
+			if !ok {
+				rest = append(rest, f)
+				continue
+			}
+			m.origin().PID = int(pid)
+			continue
+		}
+		switch f.Key {
+		case metaPrefix + "host":
+			m.origin().Host = s
+		case metaPrefix + "program":
+			m.origin().Program = s
+		case metaPrefix + "service":
+			m.origin().Service = s
+		case metaPrefix + "name":
+			m.Name = s
+		case metaPrefix + "caller":
+			i := strings.LastIndexByte(s, ':')
+			line, err := strconv.Atoi(s[i+1:])
+			if i < 0 || err != nil {
+				rest = append(rest, f)
+				continue
+			}
+			if m.Caller == nil {
+				m.Caller = &Caller{}
+			}
+			m.Caller.File, m.Caller.Line = s[:i], line
+		case metaPrefix + "hop":
+			h, ok := hopFromString(s)
+			if !ok {
+				rest = append(rest, f)
+				continue
+			}
+			m.Hops = append(m.Hops, h)
+		case metaPrefix + "function":
+			if m.Caller == nil {
+				m.Caller = &Caller{}
+			}
+			m.Caller.Function = s
+		default:
+			rest = append(rest, f)
+		}
+	}
+	return rest
+}
+
+// origin returns the Origin of m, which is created when m has none yet.
+func (m *Message) origin() *Origin {
+	if m.Origin == nil {
+		m.Origin = &Origin{}
+	}
+	return m.Origin
+}
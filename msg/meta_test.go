@@ -0,0 +1,152 @@
+package msg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewCaller(t *testing.T) {
+	got := NewCaller("/home/me/go/src/github.com/me/prog/main/main.go", 12, "github.com/me/prog/pkg.(*T).Run")
+	want := &Caller{File: "main/main.go", Line: 12, Function: "pkg.(*T).Run"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewCaller() = %+v, want %+v", got, want)
+	}
+	if got := NewCaller("main.go", 1, "main.main"); got.File != "main.go" || got.Function != "main.main" {
+		t.Errorf("NewCaller() = %+v, want File main.go and Function main.main", got)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	caller := &Caller{File: "main/main.go", Line: 12, Function: "main.main"}
+	for _, test := range []struct {
+		m    *Message
+		want string
+	}{
+		{
+			m:    &Message{Type: Info, Timestamp: []byte("now"), Message: "hello", Caller: caller},
+			want: "now | I | hello | @caller=main/main.go:12 @function=main.main\n",
+		},
+		{
+			m:    &Message{Type: Info, Timestamp: []byte("now"), Message: "hello", Caller: caller, Fields: []Field{Int("user", 42)}},
+			want: "now | I | hello | @caller=main/main.go:12 @function=main.main user=42\n",
+		},
+		{
+			m:    &Message{Type: Info, Format: JSON, Timestamp: []byte("now"), Message: "hello", Caller: caller, Fields: []Field{Int("user", 42)}},
+			want: `{"timestamp":"now","level":"info","message":"hello","caller":{"file":"main/main.go","line":12,"function":"main.main"},"fields":{"user":42}}` + "\n",
+		},
+	} {
+		b := BytesFromMessage(test.m)
+		if got := string(b[0]); got != test.want {
+			t.Errorf("BytesFromMessage(%+v) = %q, want %q", test.m, got, test.want)
+		}
+		got, err := ParseStrict(b[0])
+		if err != nil {
+			t.Fatalf("ParseStrict(%q) = _,%v, want nil error", string(b[0]), err)
+		}
+		if !reflect.DeepEqual(got, test.m) {
+			t.Errorf("ParseStrict(%q) = %+v, want %+v", string(b[0]), got, test.m)
+		}
+	}
+
+	// Reserved keys that aren't metadata, or that are malformed, stay fields.
+	m, err := ParseStrict([]byte("now | I | hello | @caller=nowhere @other=1\n"))
+	if err != nil {
+		t.Fatalf("ParseStrict() = _,%v, want nil error", err)
+	}
+	want := []Field{String("@caller", "nowhere"), Int("@other", 1)}
+	if m.Caller != nil || !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("ParseStrict() = %+v, want no caller and fields %v", m, want)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	o := NewOrigin("api")
+	if o.Host == "" || o.PID == 0 || o.Program == "" || o.Service != "api" {
+		t.Errorf("NewOrigin(%q) = %+v, want all set", "api", o)
+	}
+
+	origin := &Origin{Host: "web1", PID: 42, Program: "prog", Service: "api"}
+	caller := &Caller{File: "main/main.go", Line: 12}
+	for _, test := range []struct {
+		m    *Message
+		want string
+	}{
+		{
+			m:    &Message{Type: Warn, Timestamp: []byte("now"), Message: "hello", Origin: origin},
+			want: `now | W | hello | @host=web1 @pid=42 @program=prog @service=api` + "\n",
+		},
+		{
+			m:    &Message{Type: Warn, Timestamp: []byte("now"), Message: "hello", Origin: &Origin{Host: "web1"}, Caller: caller},
+			want: `now | W | hello | @host=web1 @caller=main/main.go:12` + "\n",
+		},
+		{
+			m:    &Message{Type: Debug, Timestamp: []byte("now"), Message: "hello", Origin: &Origin{PID: 42}, Name: "db.pool", Caller: caller},
+			want: `now | D | hello | @pid=42 @name=db.pool @caller=main/main.go:12` + "\n",
+		},
+		{
+			m:    &Message{Type: Debug, Format: JSON, Timestamp: []byte("now"), Message: "hello", Name: "db.pool"},
+			want: `{"timestamp":"now","level":"debug","message":"hello","name":"db.pool"}` + "\n",
+		},
+		{
+			m:    &Message{Type: Warn, Format: JSON, Timestamp: []byte("now"), Message: "hello", Origin: origin},
+			want: `{"timestamp":"now","level":"warn","message":"hello","origin":{"host":"web1","pid":42,"program":"prog","service":"api"}}` + "\n",
+		},
+	} {
+		b := BytesFromMessage(test.m)
+		if got := string(b[0]); got != test.want {
+			t.Errorf("BytesFromMessage(%+v) = %q, want %q", test.m, got, test.want)
+		}
+		got, err := ParseStrict(b[0])
+		if err != nil {
+			t.Fatalf("ParseStrict(%q) = _,%v, want nil error", string(b[0]), err)
+		}
+		if !reflect.DeepEqual(got, test.m) {
+			t.Errorf("ParseStrict(%q) = %+v, want %+v", string(b[0]), got, test.m)
+		}
+	}
+
+	// A pid that isn't a number stays a field.
+	m, err := ParseStrict([]byte("now | I | hello | @pid=x\n"))
+	if err != nil {
+		t.Fatalf("ParseStrict() = _,%v, want nil error", err)
+	}
+	if want := []Field{String("@pid", "x")}; m.Origin != nil || !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("ParseStrict() = %+v, want no origin and fields %v", m, want)
+	}
+}
+
+func TestHops(t *testing.T) {
+	hops := []Hop{
+		{Server: "relay", Peer: "10.0.0.5:4242", Received: time.Date(2022, 1, 2, 3, 4, 5, 123456000, time.UTC)},
+		{Server: "central", Received: time.Date(2022, 1, 2, 3, 4, 6, 0, time.UTC)},
+	}
+	for _, test := range []struct {
+		m    *Message
+		want string
+	}{
+		{
+			m: &Message{Type: Info, Timestamp: []byte("now"), Message: "hello", Hops: hops, Fields: []Field{Int("user", 1)}},
+			want: `now | I | hello | @hop="2022-01-02T03:04:05.123456Z 10.0.0.5:4242 relay" ` +
+				`@hop="2022-01-02T03:04:06.000000Z - central" user=1` + "\n",
+		},
+		{
+			m: &Message{Type: Info, Format: JSON, Timestamp: []byte("now"), Message: "hello", Hops: hops},
+			want: `{"timestamp":"now","level":"info","message":"hello","hops":[` +
+				`{"server":"relay","peer":"10.0.0.5:4242","received":"2022-01-02T03:04:05.123456Z"},` +
+				`{"server":"central","received":"2022-01-02T03:04:06Z"}]}` + "\n",
+		},
+	} {
+		b := BytesFromMessage(test.m)
+		if got := string(b[0]); got != test.want {
+			t.Errorf("BytesFromMessage(%+v) = %q, want %q", test.m, got, test.want)
+		}
+		got, err := ParseStrict(b[0])
+		if err != nil {
+			t.Fatalf("ParseStrict(%q) = _,%v, want nil error", string(b[0]), err)
+		}
+		if !reflect.DeepEqual(got, test.m) {
+			t.Errorf("ParseStrict(%q) = %+v, want %+v", string(b[0]), got, test.m)
+		}
+	}
+}
@@ -7,11 +7,15 @@ import (
 )
 
 const (
-	debugTag   byte = 'D' // Tags for Debug(f) etc.
-	infoTag         = 'I'
-	warnTag         = 'W'
-	fatalTag        = 'F'
-	unknownTag      = '?' // For reparsing misses
+	traceTag    byte = 'T' // Tags for Trace(f), Debug(f) etc.
+	debugTag         = 'D'
+	infoTag          = 'I'
+	noticeTag        = 'N'
+	warnTag          = 'W'
+	errorTag         = 'E'
+	criticalTag      = 'C'
+	fatalTag         = 'F'
+	unknownTag       = '?' // For reparsing misses
 
 	separator = '|' // Message parts are separated by space, separator, space
 	space     = ' '
@@ -24,35 +28,83 @@ var (
 
 type MsgType int
 
+// Message types in order of severity, so that filters can use ranges.
 const (
-	Debug   MsgType = iota // debug level: keep at zero for the tests (or fix msg_test.go)
-	Info                   // info level
-	Warn                   // warn: won't be dropped
-	Fatal                  // terminal: won't be dropped and kills
-	Unknown                // keep as last (sentinel) for the tests
+	Trace    MsgType = iota // finer than debug: keep as first for the tests
+	Debug                   // debug level
+	Info                    // info level
+	Notice                  // normal but significant: won't be dropped
+	Warn                    // warn: won't be dropped
+	Error                   // recoverable error: won't be dropped
+	Critical                // severe error, but the program continues: won't be dropped
+	Fatal                   // terminal: won't be dropped and kills
+	Unknown                 // keep as last (sentinel) for the tests
 )
 
 var tagForType = map[MsgType]byte{
-	Debug:   debugTag,
-	Info:    infoTag,
-	Warn:    warnTag,
-	Fatal:   fatalTag,
-	Unknown: unknownTag,
+	Trace:    traceTag,
+	Debug:    debugTag,
+	Info:     infoTag,
+	Notice:   noticeTag,
+	Warn:     warnTag,
+	Error:    errorTag,
+	Critical: criticalTag,
+	Fatal:    fatalTag,
+	Unknown:  unknownTag,
 }
 
 var typeForTag = map[byte]MsgType{
-	debugTag:   Debug,
-	infoTag:    Info,
-	warnTag:    Warn,
-	fatalTag:   Fatal,
-	unknownTag: Unknown,
+	traceTag:    Trace,
+	debugTag:    Debug,
+	infoTag:     Info,
+	noticeTag:   Notice,
+	warnTag:     Warn,
+	errorTag:    Error,
+	criticalTag: Critical,
+	fatalTag:    Fatal,
+	unknownTag:  Unknown,
+}
+
+var nameForType = map[MsgType]string{
+	Trace:    "trace",
+	Debug:    "debug",
+	Info:     "info",
+	Notice:   "notice",
+	Warn:     "warn",
+	Error:    "error",
+	Critical: "critical",
+	Fatal:    "fatal",
+	Unknown:  "unknown",
+}
+
+func (t MsgType) String() string {
+	if name, ok := nameForType[t]; ok {
+		return name
+	}
+	return nameForType[Unknown]
+}
+
+// TypeFromString is the reverse of MsgType.String. Unsupported names map to Unknown.
+func TypeFromString(s string) MsgType {
+	for t, name := range nameForType {
+		if name == s {
+			return t
+		}
+	}
+	return Unknown
 }
 
 type Message struct {
 	Type       MsgType
+	Format     Format // defaults to Text
 	TimeFormat string
 	Timestamp  []byte
 	Message    string
+	Fields     []Field // optional key/value pairs, sent along with every line of Message
+	Origin     *Origin // optional, who emitted the message
+	Name       string  // optional, the named logger that emitted the message, e.g. "db.pool"
+	Caller     *Caller // optional, where the message was emitted
+	Hops       []Hop   // optional, servers that received the message, oldest first
 }
 
 func BytesFromMessage(m *Message) [][]byte {
@@ -68,19 +120,39 @@ func BytesFromMessage(m *Message) [][]byte {
 		}
 		timestamp = []byte(now.Format(timeFormat))
 	}
+	if m.Format == JSON {
+		return jsonFromMessage(m, timestamp)
+	}
+
 	prefix := append(timestamp, space, separator, space, tagForType[m.Type], space, separator, space)
+	var suffix []byte
+	if meta := metaToText(m); meta != "" {
+		suffix = append([]byte{space, separator, space}, meta...)
+		if len(m.Fields) > 0 {
+			suffix = append(append(suffix, space), fieldsToText(m.Fields)...)
+		}
+	} else if len(m.Fields) > 0 {
+		suffix = append([]byte{space, separator, space}, fieldsToText(m.Fields)...)
+	}
+	suffix = append(suffix, '\n')
+
 	out := [][]byte{}
 	for _, line := range strings.Split(m.Message, "\n") {
 		if line == "" {
 			continue
 		}
-		lineBytes := append(append(prefix, []byte(line)...), '\n')
+		line = escapeText(line)
+		lineBytes := make([]byte, 0, len(prefix)+len(line)+len(suffix))
+		lineBytes = append(append(append(lineBytes, prefix...), line...), suffix...)
 		out = append(out, lineBytes)
 	}
 	return out
 }
 
 func TypeFromBytes(msg []byte) MsgType {
+	if FormatFromBytes(msg) == JSON {
+		return typeFromJSON(msg)
+	}
 	parts := bytes.Split(msg, []byte{space, separator, space})
 	if len(parts) < 3 || len(parts[1]) != 1 {
 		return Unknown
@@ -8,7 +8,7 @@ import (
 
 // Check that tagforType and typeForTag are complete.
 func TestMaps(t *testing.T) {
-	for tp := Debug; tp <= Unknown; tp++ {
+	for tp := Trace; tp <= Unknown; tp++ {
 		tag, ok := tagForType[tp]
 		if !ok {
 			t.Errorf("tagForType[%v] is not defined", tp)
@@ -54,6 +54,22 @@ func TestBytesFromMessage(t *testing.T) {
 		}
 	}
 
+	// Check that every line gets its own text and the fields.
+	b := BytesFromMessage(&Message{
+		Type:      Info,
+		Timestamp: []byte("now"),
+		Message:   "first line\nsecond",
+		Fields:    []Field{Int("user", 42)},
+	})
+	for i, want := range []string{
+		"now | I | first line | user=42\n",
+		"now | I | second | user=42\n",
+	} {
+		if string(b[i]) != want {
+			t.Errorf("BytesFromMessage line %v = %q, want %q", i, string(b[i]), want)
+		}
+	}
+
 	// Check that UTCTime is correctly handled.
 	msg := &Message{
 		Type:       Warn,
@@ -76,7 +92,7 @@ func TestTypeFromBytes(t *testing.T) {
 		Timestamp:  []byte(time.Now().Format("")),
 		Message:    "hello world",
 	}
-	for tp := Debug; tp <= Unknown; tp++ {
+	for tp := Trace; tp <= Unknown; tp++ {
 		msg.Type = tp
 		b := BytesFromMessage(msg)
 		out := TypeFromBytes(b[0])
@@ -0,0 +1,45 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Parse turns a line that was produced by BytesFromMessage back into a Message, in either format.
+// It is the reverse of BytesFromMessage, except that the TimeFormat can't be recovered: the
+// Timestamp is kept as it was sent. Parse is lenient: a line that can't be parsed becomes an
+// Unknown message with the line as text, so that nothing is lost. Use ParseStrict to get an error
+// instead.
+func Parse(buf []byte) (*Message, error) {
+	if FormatFromBytes(buf) == JSON {
+		return parseJSON(buf, false)
+	}
+	return parseText(buf, false)
+}
+
+// ParseStrict is like Parse, but reports malformed lines.
+func ParseStrict(buf []byte) (*Message, error) {
+	if len(buf) == 0 {
+		return nil, errors.New("empty line")
+	}
+	if FormatFromBytes(buf) == JSON {
+		return parseJSON(buf, true)
+	}
+	return parseText(buf, true)
+}
+
+// Time returns the Timestamp of a message as a time.Time. The Timestamp is tried against the
+// TimeFormat of the message, then against DefaultTimeFormat, then against RFC3339.
+func (m *Message) Time() (time.Time, error) {
+	formats := []string{DefaultTimeFormat, time.RFC3339Nano}
+	if m.TimeFormat != "" {
+		formats = append([]string{m.TimeFormat}, formats...)
+	}
+	for _, f := range formats {
+		if t, err := time.ParseInLocation(f, string(m.Timestamp), time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q doesn't match any known time format", string(m.Timestamp))
+}
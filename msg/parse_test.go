@@ -0,0 +1,150 @@
+package msg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRoundtrip(t *testing.T) {
+	for _, format := range []Format{Text, JSON} {
+		for tp := Trace; tp <= Unknown; tp++ {
+			for _, fields := range [][]Field{
+				nil,
+				{String("req", "abc def"), Int("user", 42), Float("f", 1.5), Bool("ok", true)},
+			} {
+				m := &Message{
+					Type:      tp,
+					Format:    format,
+					Timestamp: []byte("2021-12-05 12:31:00 CET"),
+					Message:   "hello | world",
+					Fields:    fields,
+				}
+				b := BytesFromMessage(m)
+				got, err := ParseStrict(b[0])
+				if err != nil {
+					t.Fatalf("ParseStrict(%q) = _,%v, want nil error", string(b[0]), err)
+				}
+				if !reflect.DeepEqual(got, m) {
+					t.Errorf("ParseStrict(%q) = %+v, want %+v", string(b[0]), got, m)
+				}
+			}
+		}
+	}
+}
+
+func TestParseSeparatorsInText(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		fields   []Field
+		origin   *Origin
+		wantLine string
+	}{
+		{
+			text:     "status | code=200",
+			wantLine: `now | I | status \| code=200` + "\n",
+		},
+		{
+			text:     "status | code=200",
+			fields:   []Field{Int("code", 404)},
+			wantLine: `now | I | status \| code=200 | code=404` + "\n",
+		},
+		{
+			text:     `a \| b | | c \\| d`,
+			wantLine: `now | I | a \\| b \| \| c \\\| d` + "\n",
+		},
+		{
+			text:     "ends with |",
+			fields:   []Field{Int("n", 1)},
+			wantLine: `now | I | ends with \| | n=1` + "\n",
+		},
+		{
+			text:     `| starts, ends with \|`,
+			wantLine: `now | I | | starts, ends with \\|` + "\n",
+		},
+		{
+			text:     "a|b |c| d",
+			wantLine: "now | I | a|b |c| d\n",
+		},
+		{
+			text:     "hello",
+			fields:   []Field{String("path", "a | b")},
+			wantLine: `now | I | hello | path="a \x7c b"` + "\n",
+		},
+		{
+			text:     "hello",
+			origin:   &Origin{Service: "a | b"},
+			wantLine: `now | I | hello | @service="a \x7c b"` + "\n",
+		},
+	} {
+		m := &Message{Type: Info, Timestamp: []byte("now"), Message: test.text, Fields: test.fields, Origin: test.origin}
+		b := BytesFromMessage(m)
+		if got := string(b[0]); got != test.wantLine {
+			t.Errorf("BytesFromMessage(%q) = %q, want %q", test.text, got, test.wantLine)
+		}
+		got, err := ParseStrict(b[0])
+		if err != nil {
+			t.Fatalf("ParseStrict(%q) = _,%v, want nil error", string(b[0]), err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("ParseStrict(%q) = %+v, want %+v", string(b[0]), got, m)
+		}
+		j := Convert(b[0], JSON)
+		if got, _ := ParseStrict(j[0]); got.Message != test.text || !reflect.DeepEqual(got.Fields, test.fields) || !reflect.DeepEqual(got.Origin, test.origin) {
+			t.Errorf("Convert(%q, JSON) = %q, want message %q and fields %v", string(b[0]), string(j[0]), test.text, test.fields)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"just a line\n",
+		"now | loud | hello\n",
+		"now | X | hello\n",
+		`{"level":"info"` + "\n",
+		`{"level":"loud","message":"hello"}` + "\n",
+	} {
+		if _, err := ParseStrict([]byte(line)); err == nil {
+			t.Errorf("ParseStrict(%q) = _,nil, want error", line)
+		}
+		m, err := Parse([]byte(line))
+		if err != nil {
+			t.Errorf("Parse(%q) = _,%v, want nil error", line, err)
+		} else if m.Type != Unknown {
+			t.Errorf("Parse(%q) gives type %v, want %v", line, m.Type, Unknown)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	for _, test := range []struct {
+		m         *Message
+		wantError bool
+	}{
+		{
+			m: &Message{Timestamp: []byte(now.Format(DefaultTimeFormat))},
+		},
+		{
+			m: &Message{Timestamp: []byte(now.Format(time.RFC3339))},
+		},
+		{
+			m: &Message{TimeFormat: time.Kitchen + " 2006-01-02", Timestamp: []byte(now.Format(time.Kitchen + " 2006-01-02"))},
+		},
+		{
+			m:         &Message{Timestamp: []byte("yesterday")},
+			wantError: true,
+		},
+	} {
+		got, err := test.m.Time()
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("Time() for %q = _,%v, want error: %v", string(test.m.Timestamp), err, test.wantError)
+			continue
+		}
+		// Kitchen time has no seconds, compare at the minute.
+		if !test.wantError && !got.Truncate(time.Minute).Equal(now.Truncate(time.Minute)) {
+			t.Errorf("Time() for %q = %v, want %v", string(test.m.Timestamp), got, now)
+		}
+	}
+}
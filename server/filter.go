@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// Filter decides which messages a fan-out client gets: messages with a type between Min and Max
+// (inclusive), from an origin that matches Host, Program and Service when these are set, and
+// with a matching text when Match is set. Use NewFilter() for a filter that passes everything, and
+// narrow it down from there.
+type Filter struct {
+	Min     msg.MsgType    // lowest type to pass
+	Max     msg.MsgType    // highest type to pass
+	Host    string         // when not empty, a glob (see path.Match) for the host of the origin
+	Program string         // same, for the program
+	Service string         // same, for the service
+	Match   *regexp.Regexp // when not nil, messages must match
+}
+
+func NewFilter() *Filter {
+	return &Filter{
+		Min: msg.Trace,
+		Max: msg.Unknown,
+	}
+}
+
+// ParseFilter returns a filter from a specification like "min=warn,max=fatal,host=web*,match=REGEXP".
+// All parts are optional, but match= must be the last one: the regular expression is what
+// follows it, commas included.
+func ParseFilter(spec string) (*Filter, error) {
+	f := NewFilter()
+	for spec != "" {
+		var part string
+		if strings.HasPrefix(spec, "match=") {
+			part, spec = spec, ""
+		} else if i := strings.IndexByte(spec, ','); i >= 0 {
+			part, spec = spec[:i], spec[i+1:]
+		} else {
+			part, spec = spec, ""
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("filter %q: expected key=value", part)
+		}
+		switch kv[0] {
+		case "min", "max":
+			t := msg.TypeFromString(kv[1])
+			if t == msg.Unknown && kv[1] != msg.Unknown.String() {
+				return nil, fmt.Errorf("filter %q: unknown message type %q", part, kv[1])
+			}
+			if kv[0] == "min" {
+				f.Min = t
+			} else {
+				f.Max = t
+			}
+		case "host", "program", "service":
+			if _, err := path.Match(kv[1], ""); err != nil {
+				return nil, fmt.Errorf("filter %q: %v", part, err)
+			}
+			switch kv[0] {
+			case "host":
+				f.Host = kv[1]
+			case "program":
+				f.Program = kv[1]
+			default:
+				f.Service = kv[1]
+			}
+		case "match":
+			re, err := regexp.Compile(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("filter %q: %v", part, err)
+			}
+			f.Match = re
+		default:
+			return nil, fmt.Errorf("filter %q: unsupported, use min=TYPE, max=TYPE, host=GLOB, program=GLOB, service=GLOB or match=REGEXP", part)
+		}
+	}
+	if f.Min > f.Max {
+		return nil, fmt.Errorf("filter: min %v is above max %v", f.Min, f.Max)
+	}
+	return f, nil
+}
+
+// Passes returns true when the message should be sent to the client. A nil filter passes
+// everything.
+func (f *Filter) Passes(m *msg.Message) bool {
+	if f == nil {
+		return true
+	}
+	if m.Type < f.Min || m.Type > f.Max {
+		return false
+	}
+	if f.Host != "" || f.Program != "" || f.Service != "" {
+		// Messages that don't state their origin can't match.
+		if m.Origin == nil || !globMatch(f.Host, m.Origin.Host) ||
+			!globMatch(f.Program, m.Origin.Program) || !globMatch(f.Service, m.Origin.Service) {
+			return false
+		}
+	}
+	return f.Match == nil || f.Match.MatchString(m.Message)
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return "all"
+	}
+	s := fmt.Sprintf("min=%v,max=%v", f.Min, f.Max)
+	for _, kv := range [][2]string{{"host", f.Host}, {"program", f.Program}, {"service", f.Service}} {
+		if kv[1] != "" {
+			s += "," + kv[0] + "=" + kv[1]
+		}
+	}
+	if f.Match != nil {
+		s += ",match=" + f.Match.String()
+	}
+	return s
+}
+
+// globMatch is true when value matches the glob pattern, or when there's no pattern.
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
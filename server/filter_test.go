@@ -0,0 +1,107 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, test := range []struct {
+		spec      string
+		want      string
+		wantError string
+	}{
+		{
+			// empty: everything
+			spec: "",
+			want: "min=trace,max=unknown",
+		},
+		{
+			spec: "min=warn",
+			want: "min=warn,max=unknown",
+		},
+		{
+			spec: "min=info,max=warn",
+			want: "min=info,max=warn",
+		},
+		{
+			// match eats the rest, commas included
+			spec: "max=fatal,match=^(a|b),c$",
+			want: "min=trace,max=fatal,match=^(a|b),c$",
+		},
+		{
+			spec: "host=web*,service=api,min=warn",
+			want: "min=warn,max=unknown,host=web*,service=api",
+		},
+		{
+			spec:      "program=[",
+			wantError: "syntax error",
+		},
+		{
+			spec:      "min=loud",
+			wantError: "unknown message type",
+		},
+		{
+			spec:      "min=fatal,max=debug",
+			wantError: "is above max",
+		},
+		{
+			spec:      "match=(",
+			wantError: "missing closing",
+		},
+		{
+			spec:      "level=warn",
+			wantError: "unsupported",
+		},
+		{
+			spec:      "min",
+			wantError: "expected key=value",
+		},
+	} {
+		f, err := ParseFilter(test.spec)
+		switch {
+		case test.wantError != "" && err == nil:
+			t.Errorf("ParseFilter(%q) = %v,nil, want error with %q", test.spec, f, test.wantError)
+		case test.wantError != "" && !strings.Contains(err.Error(), test.wantError):
+			t.Errorf("ParseFilter(%q) = _,%v, want error with %q", test.spec, err, test.wantError)
+		case test.wantError == "" && err != nil:
+			t.Errorf("ParseFilter(%q) = _,%v, want nil error", test.spec, err)
+		case test.wantError == "" && f.String() != test.want:
+			t.Errorf("ParseFilter(%q) = %v, want %v", test.spec, f, test.want)
+		}
+	}
+}
+
+func TestPasses(t *testing.T) {
+	pager, err := ParseFilter("min=warn,max=fatal,match=disk")
+	if err != nil {
+		t.Fatalf("ParseFilter(_) = _,%v, want nil error", err)
+	}
+	web, err := ParseFilter("host=web*,program=ngin?")
+	if err != nil {
+		t.Fatalf("ParseFilter(_) = _,%v, want nil error", err)
+	}
+	for _, test := range []struct {
+		filter *Filter
+		m      *msg.Message
+		want   bool
+	}{
+		{filter: nil, m: &msg.Message{Type: msg.Debug}, want: true},
+		{filter: NewFilter(), m: &msg.Message{Type: msg.Trace}, want: true},
+		{filter: NewFilter(), m: &msg.Message{Type: msg.Unknown}, want: true},
+		{filter: pager, m: &msg.Message{Type: msg.Info, Message: "disk full"}, want: false},
+		{filter: pager, m: &msg.Message{Type: msg.Warn, Message: "disk full"}, want: true},
+		{filter: pager, m: &msg.Message{Type: msg.Warn, Message: "cpu hot"}, want: false},
+		{filter: pager, m: &msg.Message{Type: msg.Unknown, Message: "disk full"}, want: false},
+		{filter: web, m: &msg.Message{Type: msg.Info, Origin: &msg.Origin{Host: "web1", Program: "nginx"}}, want: true},
+		{filter: web, m: &msg.Message{Type: msg.Info, Origin: &msg.Origin{Host: "db1", Program: "nginx"}}, want: false},
+		{filter: web, m: &msg.Message{Type: msg.Info, Origin: &msg.Origin{Host: "web1", Program: "php"}}, want: false},
+		{filter: web, m: &msg.Message{Type: msg.Info}, want: false},
+	} {
+		if got := test.filter.Passes(test.m); got != test.want {
+			t.Errorf("Filter %v: Passes(%+v) = %v, want %v", test.filter, test.m, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// annotate returns the message in buf with a Hop for this server appended, when the server has
+// ?hops=true. The message keeps its format. Lines that can't be parsed become Unknown messages.
+func (s *Server) annotate(buf []byte, peer net.Addr) []byte {
+	if !s.hops {
+		return buf
+	}
+	m, _ := msg.Parse(buf)
+	m.Hops = append(m.Hops, s.hop(peer))
+	return bytes.Join(msg.BytesFromMessage(m), nil)
+}
+
+// hop returns a Hop for a message that this server received from peer just now.
+func (s *Server) hop(peer net.Addr) msg.Hop {
+	h := msg.Hop{
+		Server:   s.hostname,
+		Received: time.Now().UTC(),
+	}
+	if peer != nil {
+		if p := peer.String(); p != "<nil>" { // unnamed unix sockets have a nil *net.UnixAddr
+			h.Peer = p
+		}
+	}
+	return h
+}
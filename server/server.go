@@ -1,23 +1,26 @@
 package server
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/KarelKubat/smartlog/ack"
 	"github.com/KarelKubat/smartlog/client"
 	"github.com/KarelKubat/smartlog/linebuf"
 	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/tlsconfig"
 	"github.com/KarelKubat/smartlog/uri"
 )
 
 const (
-	chSize    = 1024              // # of messages that may be buffered while fanning out
-	dropInfo  = chSize * 75 / 100 // drop Info(f) when 75% full
-	dropDebug = chSize * 50 / 100 // drop Debug(f) when 50% full
+	chSize = 1024 // default # of messages that may be buffered while fanning out
 )
 
 var (
@@ -26,38 +29,98 @@ var (
 )
 
 type Server struct {
-	URI         *uri.URI         // URI this was constructed from
-	clients     []*client.Client // clients to fan out to
-	bufCh       chan []byte      // msg channel for fanout to clients
-	tcpListener net.Listener     // in the case of a TCP server
-	udpConn     *net.UDPConn     // in the case of a UDP server
-	closed      bool             // true upon server.Close()
+	URI         *uri.URI       // URI this was constructed from
+	routes      []*route       // clients to fan out to
+	bufCh       chan *inbound  // msg channel for fanout to clients
+	tcpListener net.Listener   // in the case of a TCP, unix or TLS server
+	packetConn  net.PacketConn // in the case of a UDP or unixgram server
+	tlsConfig   *tls.Config    // in the case of a TLS server
+	ack         bool           // senders want acknowledgements, see package ack
+	hops        bool           // annotate messages with a Hop, see annotate()
+	hostname    string         // name of this server in Hops
+
+	mu         sync.Mutex        // protects the below
+	closed     bool              // true upon server.Close()
+	conns      map[net.Conn]bool // open TCP connections, closed by Close()
+	receivers  sync.WaitGroup    // Serve() and connection handlers, which may still queue messages
+	fanoutDone chan struct{}     // closed when fanout() returns, nil if it wasn't started
+	closeDone  chan struct{}     // closed when Close() is done
+}
+
+// inbound is a received message, waiting to be fanned out.
+type inbound struct {
+	buf  []byte
+	acks *acking // nil if the sender doesn't want an acknowledgement
+	seq  uint64  // sequence number for the acknowledgement
+	left int     // # of routes that didn't report yet, see acking.handled(), protected by acks.mu
+	lost bool    // a route failed to deliver, protected by acks.mu
+}
+
+// acking acknowledges the messages of a connection, in the order in which they were received.
+type acking struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	acker   *ack.Acker
+	pending sync.WaitGroup // messages that aren't handled yet
+	stopped bool           // nothing is acknowledged anymore
+}
+
+// route is a fan-out client and the filter for the messages that it gets.
+type route struct {
+	client *client.Client
+	filter *Filter // nil: all messages
 }
 
 func New(u string) (*Server, error) {
-	// Parse URI, we support: tcp://mush:port and udp://mush:port
+	// Parse URI, we support: tcp://mush:port, udp://mush:port, unix://path, unixgram://path,
+	// tls://mush:port, and for syslog syslog://mush:port, syslog+tcp://mush:port, syslog+unix://path
 	ur, err := uri.New(u)
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Server{
-		URI:   ur,
-		bufCh: make(chan []byte, chSize),
+		URI:       ur,
+		closeDone: make(chan struct{}),
+	}
+
+	// Parameters, only ?buffer=SIZE, ?ack=BOOL, ?hops=BOOL and the TLS settings are relevant to
+	// servers
+	size := chSize
+	for key, value := range ur.Params {
+		switch {
+		case key == "buffer":
+			size, _ = strconv.Atoi(value) // already checked by uri.New
+		case key == "ack":
+			s.ack, _ = strconv.ParseBool(value) // already checked by uri.New
+		case key == "hops":
+			s.hops, _ = strconv.ParseBool(value) // already checked by uri.New
+			s.hostname, _ = os.Hostname()
+		case ur.Scheme == uri.TLS && tlsconfig.IsServerParam(key):
+			// handled below, all at once
+		default:
+			return nil, fmt.Errorf("%v: parameter %q is not supported by servers", s, key)
+		}
+	}
+	s.bufCh = make(chan *inbound, size)
+	if ur.Scheme == uri.TLS {
+		if s.tlsConfig, err = tlsconfig.ForServer(ur); err != nil {
+			return nil, err
+		}
 	}
 
 	// Set the connection
 	switch ur.Scheme {
-	case uri.TCP:
+	case uri.TCP, uri.Unix, uri.TLS, uri.SyslogTCP:
 		if err := s.tcpStartListener(); err != nil {
 			return nil, err
 		}
-	case uri.UDP:
+	case uri.UDP, uri.Unixgram, uri.Syslog, uri.SyslogUnix:
 		if err := s.udpStartListener(); err != nil {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("%v: only udp:// or tcp:// servers are supported", s)
+		return nil, fmt.Errorf("%v: only udp://, tcp://, unix://, unixgram://, tls://, syslog://, syslog+tcp:// or syslog+unix:// servers are supported", s)
 	}
 
 	return s, nil
@@ -68,59 +131,117 @@ func (s *Server) String() string {
 }
 
 func (s *Server) AddClient(c *client.Client) {
-	s.clients = append(s.clients, c)
+	s.AddClientWithFilter(c, nil)
+}
+
+// AddClientWithFilter adds a fan-out client that only gets the messages that pass the filter.
+func (s *Server) AddClientWithFilter(c *client.Client, f *Filter) {
+	s.routes = append(s.routes, &route{
+		client: c,
+		filter: f,
+	})
 }
 
+// Serve receives messages and fans them out, until the server fails or is closed. In the latter case
+// it returns once Close() is done, so that all received messages are written.
 func (s *Server) Serve() error {
-	go func() {
-		s.fanout()
-	}()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.closeDone
+		return nil
+	}
+	s.receivers.Add(1)
+	s.fanoutDone = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.fanout()
+
+	err := s.serve()
+	s.receivers.Done()
+	if err != nil {
+		return err
+	}
+	<-s.closeDone
+	return nil
+}
 
+// serve runs the listener of the server, until it fails or is closed.
+func (s *Server) serve() error {
 	switch s.URI.Scheme {
-	case uri.TCP:
+	case uri.TCP, uri.Unix, uri.TLS, uri.SyslogTCP:
 		if err := s.tcpServe(); err != nil {
 			return fmt.Errorf("%v: TCP server stopped: %v", s, err)
 		}
-	case uri.UDP:
+	case uri.UDP, uri.Unixgram:
 		if err := s.udpServe(); err != nil {
 			return fmt.Errorf("%v: UDP server stopped: %v", s, err)
 		}
+	case uri.Syslog, uri.SyslogUnix:
+		if err := s.syslogPacketServe(); err != nil {
+			return fmt.Errorf("%v: syslog server stopped: %v", s, err)
+		}
 	default:
 		return errors.New("internal foobar, unhandled case in server.Serve")
 	}
 	return nil
 }
 
+// Close stops the server: it stops listening, closes the open connections, fans out the messages
+// that are still buffered, and then closes all fan-out clients, so that their queued messages are
+// written.
 func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.closeDone
+		return nil
+	}
 	s.closed = true
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
 
 	var err error
 	switch s.URI.Scheme {
-	case uri.TCP:
-		err = s.tcpListener.Close()
-	case uri.UDP:
-		err = s.udpConn.Close()
+	case uri.TCP, uri.Unix, uri.TLS, uri.SyslogTCP:
+		err = s.tcpListener.Close() // also removes the socket file of a unix server
+	case uri.UDP, uri.Syslog:
+		err = s.packetConn.Close()
+	case uri.Unixgram, uri.SyslogUnix:
+		err = s.packetConn.Close()
+		os.Remove(s.URI.Address())
+	}
+	for conn := range conns {
+		conn.Close() // the handler queues what's complete, and waits for acknowledgements
+	}
+
+	// Nothing is queued anymore once the receivers have stopped, so fanout() can drain bufCh.
+	s.receivers.Wait()
+	if s.fanoutDone != nil {
+		close(s.bufCh)
+		<-s.fanoutDone
 	}
+
+	for _, r := range s.routes {
+		if cerr := r.client.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	close(s.closeDone)
 	return err
 }
 
+// udpStartListener starts a UDP or unixgram listener.
 func (s *Server) udpStartListener() error {
 	var err error
-	var addr *net.UDPAddr
-
 	for i := 0; i < RestartAttempts; i++ {
 		time.Sleep(RestartWait * time.Duration(i))
-		addr, err = net.ResolveUDPAddr(s.URI.Scheme.String(), strings.Join(s.URI.Parts, ":"))
-		if err != nil {
-			return fmt.Errorf("%v: failed to resolve address: %v", s, err)
-		}
-		s.udpConn, err = net.ListenUDP(s.URI.Scheme.String(), addr)
+		s.removeStaleSocket()
+		s.packetConn, err = net.ListenPacket(s.URI.Scheme.Network(), s.URI.Address())
 		if err == nil {
 			return nil
 		}
-		if err != nil {
-			return fmt.Errorf("%v: failed to start UDP listener: %v", s, err)
-		}
 	}
 	return fmt.Errorf("%v: failed to start UDP listener: %v", s, err)
 }
@@ -132,9 +253,9 @@ func (s *Server) udpServe() error {
 	for {
 		for {
 			buf := make([]byte, 1024)
-			n, addr, err := s.udpConn.ReadFromUDP(buf)
+			n, addr, err := s.packetConn.ReadFrom(buf)
 			if err != nil {
-				if s.closed {
+				if s.isClosed() {
 					return nil
 				}
 				client.Warnf("%v: failed to handle UDP connection from %v: %v", s, addr, err)
@@ -147,62 +268,126 @@ func (s *Server) udpServe() error {
 			}
 			line.Add(buf, n)
 			for line.Complete() {
-				s.bufCh <- line.Statement()
+				s.bufCh <- &inbound{buf: s.annotate(line.Statement(), addr)}
 			}
 		}
 	}
 }
 
+// tcpStartListener starts a TCP, unix socket or TLS listener.
 func (s *Server) tcpStartListener() error {
 	var err error
 	for i := 0; i < RestartAttempts; i++ {
 		time.Sleep(RestartWait * time.Duration(i))
-		s.tcpListener, err = net.Listen(s.URI.Scheme.String(), strings.Join(s.URI.Parts, ":"))
+		s.removeStaleSocket()
+		s.tcpListener, err = net.Listen(s.URI.Scheme.Network(), s.URI.Address())
 		if err == nil {
+			if s.tlsConfig != nil {
+				s.tcpListener = tls.NewListener(s.tcpListener, s.tlsConfig)
+			}
 			return nil
 		}
 	}
 	return fmt.Errorf("%v: failed to start TCP listener: %v", s, err)
 }
 
+// removeStaleSocket removes the socket file of a unix or unixgram server that wasn't cleaned up,
+// e.g. after a crash. Other files are left alone, so that the listener fails to start.
+func (s *Server) removeStaleSocket() {
+	if n := s.URI.Scheme.Network(); n != "unix" && n != "unixgram" {
+		return
+	}
+	if st, err := os.Stat(s.URI.Address()); err == nil && st.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.URI.Address())
+	}
+}
+
 func (s *Server) tcpServe() error {
 	// Don't return unless the connection gets closed.
 	for {
 		conn, err := s.tcpListener.Accept()
 		if err != nil {
-			if s.closed {
+			if s.isClosed() {
 				return nil
 			}
 			client.Warnf("%v: failed to accept TCP connection: %v", s, err)
 			continue // restart listener
 		}
-		go s.handleTCPConnection(conn)
+		if !s.track(conn) {
+			conn.Close() // accepted while closing
+			return nil
+		}
+		go func() {
+			defer s.untrack(conn)
+			if s.URI.Scheme == uri.SyslogTCP {
+				s.handleSyslogConnection(conn)
+				return
+			}
+			s.handleTCPConnection(conn)
+		}()
 	}
 }
 
+// track registers an accepted connection, so that Close() can close it and wait for its handler.
+// It returns false when the server is closed.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]bool{}
+	}
+	s.conns[conn] = true
+	s.receivers.Add(1)
+	return true
+}
+
+// untrack reports that the handler of a connection is done.
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.receivers.Done()
+}
+
+// isClosed returns true once Close() is called.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
 func (s *Server) handleTCPConnection(conn net.Conn) {
 	line := linebuf.New()
+	var acks *acking
+	if s.ack {
+		acks = &acking{conn: conn, acker: ack.NewAcker(conn)}
+	}
 	var err error
 	defer func() {
 		for line.Complete() {
-			s.bufCh <- line.Statement()
+			s.queue(line.Statement(), conn.RemoteAddr(), acks)
 		}
-		if err != nil {
-			fmt.Println(err)
-		}
-		if err != nil && err.Error() != "EOF" {
+		if err != nil && err.Error() != "EOF" && (acks == nil || !acks.isStopped()) {
 			client.Warnf("%v: failed to handle TCP connection from %v: %v", s, conn.RemoteAddr(), err)
 		}
+		if acks != nil {
+			acks.stop()
+		}
 		conn.Close()
 	}()
 
 	for {
 		buf := make([]byte, 1024)
-		n, err := conn.Read(buf)
+		var n int
+		n, err = conn.Read(buf)
 		if n > 0 {
 			line.Add(buf, n)
 			for line.Complete() {
-				s.bufCh <- line.Statement()
+				s.queue(line.Statement(), conn.RemoteAddr(), acks)
 			}
 		}
 		if err != nil {
@@ -211,48 +396,140 @@ func (s *Server) handleTCPConnection(conn net.Conn) {
 	}
 }
 
+// queue queues a message received from peer for fanout. When the sender wants an acknowledgement,
+// the message is acknowledged once all fan-out clients have delivered it, see client.Deliver().
+func (s *Server) queue(buf []byte, peer net.Addr, acks *acking) {
+	if acks == nil {
+		s.bufCh <- &inbound{buf: s.annotate(buf, peer)}
+		return
+	}
+	seq, buf, ok := ack.Unframe(buf)
+	if !ok {
+		// Not framed, the sender doesn't want acknowledgements after all
+		s.bufCh <- &inbound{buf: s.annotate(buf, peer)}
+		return
+	}
+	acks.pending.Add(1)
+	s.bufCh <- &inbound{
+		buf:  s.annotate(buf, peer),
+		acks: acks,
+		seq:  seq,
+	}
+}
+
+// handled reports that a route has delivered in (ok), or lost it. Once all routes have reported,
+// the message is acknowledged. Routes report in order, so messages are acknowledged in order.
+func (a *acking) handled(in *inbound, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	in.lost = in.lost || !ok
+	if in.left--; in.left > 0 {
+		return
+	}
+	defer a.pending.Done()
+	if a.stopped {
+		return
+	}
+	if in.lost {
+		// Acknowledging later messages would acknowledge this one too. Instead, the sender
+		// reconnects and sends the unacknowledged messages again.
+		a.stopped = true
+		a.conn.Close()
+		return
+	}
+	a.acker.Handled(in.seq)
+}
+
+// isStopped is true when a message was lost, see handled().
+func (a *acking) isStopped() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopped
+}
+
+// stop waits up to ack.Timeout until the pending messages are handled, and sends the last
+// acknowledgement.
+func (a *acking) stop() {
+	handled := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(ack.Timeout):
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopped = true
+	a.acker.Stop()
+}
+
 func (s *Server) fanout() {
-	// fanout() never returns, but forever consumes messages from the bufCh
+	// fanout() consumes messages from the bufCh until Close() closes it
+	defer close(s.fanoutDone)
 	var dropped bool
 
-	for {
-		buf := <-s.bufCh
+	for in := range s.bufCh {
+		buf := in.buf
 
-		// The threshold to drop debug messages is lowest. If that is overrun then we need to reparse the message,
-		// see what type it is and maybe drop it.
+		// The threshold to drop trace messages is lowest. If that is overrun then we need to reparse the message,
+		// see what type it is and maybe drop it. Messages that the sender wants acknowledged are never dropped.
 		chLen := len(s.bufCh)
-		if chLen > dropDebug {
-			var shouldDrop bool
-			t := msg.TypeFromBytes(buf)
-			switch t {
-			case msg.Debug:
-				shouldDrop = true
-			case msg.Info:
-				if chLen > dropInfo {
-					shouldDrop = true
-				}
-			}
-			if shouldDrop {
-				if !dropped {
-					dropped = true
-					client.Warnf("%v: dropping debug/info message(s), %v already buffered, limit %v", s, chLen, dropInfo)
-					continue
-				}
+		if in.acks == nil && chLen > cap(s.bufCh)*msg.DropTracePct/100 && msg.Droppable(msg.TypeFromBytes(buf), chLen, cap(s.bufCh)) {
+			if !dropped {
+				dropped = true
+				client.Warnf("%v: dropping trace/debug/info message(s), %v already buffered, limit %v", s, chLen, cap(s.bufCh))
 			}
+			continue
 		}
 
 		dropped = false
 		var wg sync.WaitGroup
-		for _, c := range s.clients {
+		var m *msg.Message          // parsed when a filter needs it
+		in.left = len(s.routes) + 1 // and 1 for fanout() itself, so that routes can't finish early
+		for _, r := range s.routes {
+			if r.filter != nil {
+				if m == nil {
+					m, _ = msg.Parse(buf)
+				}
+				if !r.filter.Passes(m) {
+					in.handled(true)
+					continue
+				}
+			}
 			wg.Add(1)
-			go func(c *client.Client, buf []byte) {
-				if err := c.Passthru(buf); err != nil {
-					client.Warnf("%v: failed to fanout to client %v: %v, buf %v",
-						s, c, err, strings.TrimRight(string(buf), "\n"))
+			go func(c *client.Client, in *inbound) {
+				defer wg.Done()
+				if in.acks == nil {
+					if err := c.Passthru(in.buf); err != nil {
+						s.warnFanout(c, in.buf, err)
+					}
+					return
 				}
-				wg.Done()
-			}(c, buf)
+				c.Deliver(in.buf, func(err error) {
+					if err != nil {
+						s.warnFanout(c, in.buf, err)
+					}
+					in.handled(err == nil)
+				})
+			}(r.client, in)
 		}
 		wg.Wait()
+		in.handled(true)
+	}
+}
+
+// warnFanout reports that buf couldn't be fanned out to c.
+func (s *Server) warnFanout(c *client.Client, buf []byte, err error) {
+	client.Warnf("%v: failed to fanout to client %v: %v, buf %v", s, c, err, strings.TrimRight(string(buf), "\n"))
+}
+
+// handled reports that a route has delivered the message (ok), or lost it.
+func (in *inbound) handled(ok bool) {
+	if in.acks != nil {
+		in.acks.handled(in, ok)
 	}
 }
@@ -1,8 +1,24 @@
 package server
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/client/any"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/tlsconfig/tlstest"
+	"github.com/KarelKubat/smartlog/uri"
 )
 
 // We can only test the bubbling up of errors. Intergration tests are handled elsewhere.
@@ -17,9 +33,14 @@ func TestNew(t *testing.T) {
 			wantError: "scheme://rest",
 		},
 		{
-			// Only tcp:// or udp:// are allowed
+			// Only network schemes are allowed
 			u:         "file://stdout",
-			wantError: "only udp:// or tcp://",
+			wantError: "only udp://, tcp://, unix://, unixgram://, tls://, syslog://",
+		},
+		{
+			// Client-only parameters are rejected
+			u:         "tcp://:0?format=json",
+			wantError: "not supported by servers",
 		},
 	} {
 		_, err := New(test.u)
@@ -28,3 +49,426 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestBuffer(t *testing.T) {
+	s, err := New("udp://localhost:0?buffer=16")
+	if err != nil {
+		t.Fatalf("New(_) = _,%v, need nil error", err)
+	}
+	defer s.Close()
+	if got := cap(s.bufCh); got != 16 {
+		t.Errorf("New(_) with buffer=16 gives a buffer of %v, want 16", got)
+	}
+}
+
+// serveAndSend starts a server on the URI with a file client, sends a message to it, and returns what ends up
+// in the file.
+func serveAndSend(t *testing.T, serverURI, clientURI string) string {
+	s, err := New(serverURI)
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", serverURI, err)
+	}
+	defer s.Close()
+	name := filepath.Join(t.TempDir(), "out.log")
+	fileClient, err := any.New("file://" + name)
+	if err != nil {
+		t.Fatalf("any.New(file://%v) = _,%v, need nil error", name, err)
+	}
+	s.AddClient(fileClient)
+	go s.Serve()
+
+	cl, err := any.New(clientURI)
+	if err != nil {
+		t.Fatalf("any.New(%q) = _,%v, need nil error", clientURI, err)
+	}
+	if err := cl.Info("hello over " + clientURI); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+	for i := 0; i < 50; i++ {
+		b, _ := ioutil.ReadFile(name)
+		if len(b) > 0 {
+			return string(b)
+		}
+		time.Sleep(time.Second / 100)
+	}
+	return ""
+}
+
+func TestUnixSockets(t *testing.T) {
+	dir := t.TempDir()
+	for _, u := range []string{
+		"unix://" + filepath.Join(dir, "stream.sock"),
+		"unixgram://" + filepath.Join(dir, "dgram.sock"),
+	} {
+		got := serveAndSend(t, u, u)
+		if !strings.Contains(got, "| I | hello over "+u) {
+			t.Errorf("server %v received %q, want the sent message", u, got)
+		}
+		sock := strings.SplitN(u, "://", 2)[1]
+		if _, err := os.Stat(sock); err == nil {
+			t.Errorf("server %v: socket %v still exists after Close()", u, sock)
+		}
+	}
+}
+
+func TestIPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 on this host: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	u := fmt.Sprintf("tcp://[::1]:%v", port)
+	got := serveAndSend(t, u, u)
+	if !strings.Contains(got, "| I | hello over "+u) {
+		t.Errorf("server %v received %q, want the sent message", u, got)
+	}
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(_,_) = _,%v, need nil error", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestTLS(t *testing.T) {
+	f, err := tlstest.Write(t.TempDir())
+	if err != nil {
+		t.Fatalf("tlstest.Write(_) = _,%v, need nil error", err)
+	}
+	serverParams := "cert=" + f.ServerCert + "&key=" + f.ServerKey
+	clientCert := "&cert=" + f.ClientCert + "&key=" + f.ClientKey
+
+	for _, test := range []struct {
+		desc         string
+		serverParams string
+		clientParams string
+		wantReceived bool
+	}{
+		{
+			desc:         "server authentication",
+			serverParams: serverParams,
+			clientParams: "ca=" + f.CA,
+			wantReceived: true,
+		},
+		{
+			desc:         "mutual authentication",
+			serverParams: serverParams + "&ca=" + f.CA + "&verify-client=true",
+			clientParams: "ca=" + f.CA + clientCert,
+			wantReceived: true,
+		},
+		{
+			desc:         "client without certificate",
+			serverParams: serverParams + "&ca=" + f.CA + "&verify-client=true",
+			clientParams: "ca=" + f.CA,
+			wantReceived: false,
+		},
+	} {
+		addr := fmt.Sprintf("localhost:%v", freePort(t))
+		clientURI := "tls://" + addr + "?" + test.clientParams
+		got := serveAndSend(t, "tls://"+addr+"?"+test.serverParams, clientURI)
+		if received := strings.Contains(got, "| I | hello over "+clientURI); received != test.wantReceived {
+			t.Errorf("%v: server received %q, want the sent message: %v", test.desc, got, test.wantReceived)
+		}
+	}
+}
+
+func TestTLSUnknownServer(t *testing.T) {
+	f, err := tlstest.Write(t.TempDir())
+	if err != nil {
+		t.Fatalf("tlstest.Write(_) = _,%v, need nil error", err)
+	}
+	addr := fmt.Sprintf("localhost:%v", freePort(t))
+	s, err := New("tls://" + addr + "?cert=" + f.ServerCert + "&key=" + f.ServerKey)
+	if err != nil {
+		t.Fatalf("New(_) = _,%v, need nil error", err)
+	}
+	defer s.Close()
+	go s.Serve()
+
+	// Without ?ca=... the test CA isn't trusted, so connecting fails.
+	defer func(n int) { client.RestartAttempts = n }(client.RestartAttempts)
+	client.RestartAttempts = 1
+	if _, err := any.New("tls://" + addr); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("any.New(tls://%v) = _,%v, want certificate error", addr, err)
+	}
+}
+
+func TestCloseClosesClients(t *testing.T) {
+	u := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+	s, err := New(u)
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", u, err)
+	}
+	name := filepath.Join(t.TempDir(), "out.log")
+	fileClient, err := any.New("file://" + name + "?buffer=10")
+	if err != nil {
+		t.Fatalf("any.New(file://%v) = _,%v, need nil error", name, err)
+	}
+	s.AddClient(fileClient)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	if err := fileClient.Info("too late"); err == nil {
+		t.Errorf("Info(_) on fan-out client after server Close() = nil, want error")
+	}
+}
+
+// slowWriter collects what's written to it, slowly.
+type slowWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *slowWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestCloseDrainsBuffer(t *testing.T) {
+	u := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+	s, err := New(u)
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", u, err)
+	}
+	w := &slowWriter{}
+	s.AddClient(&client.Client{
+		URI:    &uri.URI{Scheme: uri.File, Parts: []string{"slow"}},
+		Writer: w,
+	})
+	for i := 0; i < 50; i++ {
+		s.bufCh <- &inbound{buf: msg.BytesFromMessage(&msg.Message{Type: msg.Info, Message: fmt.Sprintf("message %v", i)})[0]}
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve() }()
+	for i := 0; i < 50 && w.String() == ""; i++ {
+		time.Sleep(time.Second / 100)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v, need nil error", err)
+	}
+	if got := strings.Count(w.String(), "\n"); got != 50 {
+		t.Errorf("%v messages written after Close(), want 50", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve() = %v after Close(), want nil", err)
+	}
+}
+
+func TestDrops(t *testing.T) {
+	u := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+	s, err := New(u + "?buffer=100")
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", u, err)
+	}
+	w := &slowWriter{}
+	s.AddClient(&client.Client{
+		URI:    &uri.URI{Scheme: uri.File, Parts: []string{"slow"}},
+		Writer: w,
+	})
+
+	// When the trace and debug messages are fanned out, the buffer is about 30% full. That's enough
+	// to drop trace messages, but not debug messages.
+	for _, m := range []*msg.Message{
+		{Type: msg.Trace, Message: "trace"},
+		{Type: msg.Debug, Message: "debug"},
+	} {
+		s.bufCh <- &inbound{buf: msg.BytesFromMessage(m)[0]}
+	}
+	for i := 0; i < 29; i++ {
+		s.bufCh <- &inbound{buf: msg.BytesFromMessage(&msg.Message{Type: msg.Warn, Message: "filler"})[0]}
+	}
+	go s.Serve()
+	for i := 0; i < 50 && w.String() == ""; i++ {
+		time.Sleep(time.Second / 100)
+	}
+	s.Close()
+
+	got := w.String()
+	if strings.Contains(got, "| T | trace") || !strings.Contains(got, "| D | debug") {
+		t.Errorf("with a buffer of 30%% fanned out %q, want the debug message but not the trace message", got)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("disk on fire")
+}
+
+func TestAckAfterDelivery(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		writer   io.Writer
+		wantAcks string
+	}{
+		{desc: "delivered", writer: &slowWriter{}, wantAcks: "8\n"},
+		{desc: "lost", writer: failingWriter{}, wantAcks: ""},
+	} {
+		u := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+		s, err := New(u + "?ack=true&buffer=4")
+		if err != nil {
+			t.Fatalf("New(%q) = _,%v, need nil error", u, err)
+		}
+		s.AddClient(&client.Client{
+			URI:    &uri.URI{Scheme: uri.File, Parts: []string{test.desc}},
+			Writer: test.writer,
+		})
+		go s.Serve()
+
+		conn, err := net.Dial("tcp", strings.TrimPrefix(u, "tcp://"))
+		if err != nil {
+			t.Fatalf("net.Dial(_) = _,%v, need nil error", err)
+		}
+		// Debug messages that the sender wants acknowledged aren't dropped, though they don't fit in
+		// the buffer.
+		for i := 1; i <= 8; i++ {
+			fmt.Fprintf(conn, "%v 2022-01-01 | D | message %v\n", i, i)
+		}
+		conn.(*net.TCPConn).CloseWrite()
+
+		// The last acknowledgement comes once all messages are written. When a message is lost,
+		// the connection is closed without acknowledging it.
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		got, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Errorf("%v: reading acknowledgements: %v", test.desc, err)
+		}
+		if !strings.HasSuffix(string(got), test.wantAcks) || (test.wantAcks == "" && len(got) > 0) {
+			t.Errorf("%v: acknowledgements %q, want %q at the end", test.desc, got, test.wantAcks)
+		}
+		if w, ok := test.writer.(*slowWriter); ok {
+			if n := strings.Count(w.String(), "\n"); n != 8 {
+				t.Errorf("%v: %v messages written when acknowledged, want 8", test.desc, n)
+			}
+		}
+		conn.Close()
+		s.Close()
+	}
+}
+
+func TestAck(t *testing.T) {
+	u := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+	s, err := New(u + "?ack=true")
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", u, err)
+	}
+	defer s.Close()
+	name := filepath.Join(t.TempDir(), "out.log")
+	fileClient, err := any.New("file://" + name)
+	if err != nil {
+		t.Fatalf("any.New(file://%v) = _,%v, need nil error", name, err)
+	}
+	s.AddClient(fileClient)
+	go s.Serve()
+
+	// Clients that want acknowledgements, and clients that don't, can both send.
+	for _, cu := range []string{u + "?ack=true", u} {
+		cl, err := any.New(cu)
+		if err != nil {
+			t.Fatalf("any.New(%q) = _,%v, need nil error", cu, err)
+		}
+		for i := 0; i < 10; i++ {
+			if err := cl.Infof("message %v over %v", i, cu); err != nil {
+				t.Fatalf("Infof(_) = %v, need nil error", err)
+			}
+		}
+		// Close waits for the acknowledgements.
+		if err := cl.Close(); err != nil {
+			t.Errorf("%v: Close() = %v, want nil error", cu, err)
+		}
+	}
+
+	var got string
+	for i := 0; i < 50 && strings.Count(got, "\n") < 20; i++ {
+		time.Sleep(time.Second / 100)
+		b, _ := ioutil.ReadFile(name)
+		got = string(b)
+	}
+	for _, want := range []string{"| I | message 0 over " + u + "?ack=true\n", "| I | message 9 over " + u + "\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("server received %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHops(t *testing.T) {
+	// A client sends to a relay, which forwards to a central server. Both annotate messages.
+	centralURI := fmt.Sprintf("tcp://127.0.0.1:%v", freePort(t))
+	central, err := New(centralURI + "?hops=true")
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", centralURI, err)
+	}
+	defer central.Close()
+	name := filepath.Join(t.TempDir(), "out.log")
+	fileClient, err := any.New("file://" + name + "?format=json")
+	if err != nil {
+		t.Fatalf("any.New(file://%v) = _,%v, need nil error", name, err)
+	}
+	central.AddClient(fileClient)
+	go central.Serve()
+
+	relayURI := fmt.Sprintf("udp://127.0.0.1:%v", freePort(t))
+	relay, err := New(relayURI + "?hops=true")
+	if err != nil {
+		t.Fatalf("New(%q) = _,%v, need nil error", relayURI, err)
+	}
+	defer relay.Close()
+	forward, err := any.New(centralURI)
+	if err != nil {
+		t.Fatalf("any.New(%q) = _,%v, need nil error", centralURI, err)
+	}
+	relay.AddClient(forward)
+	go relay.Serve()
+
+	cl, err := any.New(relayURI)
+	if err != nil {
+		t.Fatalf("any.New(%q) = _,%v, need nil error", relayURI, err)
+	}
+	defer cl.Close()
+	start := time.Now()
+	if err := cl.Info("hello"); err != nil {
+		t.Fatalf("Info(_) = %v, need nil error", err)
+	}
+
+	var got []byte
+	for i := 0; i < 50 && len(got) == 0; i++ {
+		time.Sleep(time.Second / 100)
+		got, _ = ioutil.ReadFile(name)
+	}
+	m, err := msg.ParseStrict(got)
+	if err != nil {
+		t.Fatalf("ParseStrict(%q) = _,%v, need nil error", string(got), err)
+	}
+	if len(m.Hops) != 2 {
+		t.Fatalf("central server wrote %q, want 2 hops", string(got))
+	}
+	hostname, _ := os.Hostname()
+	for i, h := range m.Hops {
+		if h.Server != hostname || !strings.HasPrefix(h.Peer, "127.0.0.1:") || h.Received.Before(start.Add(-time.Second)) {
+			t.Errorf("hop %v = %+v, want server %q, a peer on 127.0.0.1 and a receive time after %v", i, h, hostname, start)
+		}
+	}
+	if m.Hops[1].Received.Before(m.Hops[0].Received) {
+		t.Errorf("hops %+v aren't in order of receipt", m.Hops)
+	}
+
+	// Clients can't annotate.
+	if _, err := any.New("tcp://localhost:2022?hops=true"); err == nil || !strings.Contains(err.Error(), "not supported by clients") {
+		t.Errorf("any.New(tcp://localhost:2022?hops=true) = _,%v, want error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/KarelKubat/smartlog/client"
+	"github.com/KarelKubat/smartlog/msg"
+	"github.com/KarelKubat/smartlog/syslog"
+)
+
+const syslogMaxSize = 64 * 1024 // max size of a syslog message
+
+// syslogPacketServe handles syslog over UDP or a unixgram socket: every datagram is a message.
+func (s *Server) syslogPacketServe() error {
+	buf := make([]byte, syslogMaxSize)
+
+	// Don't return unless the server gets closed.
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			client.Warnf("%v: failed to handle syslog datagram from %v: %v", s, addr, err)
+			if err := s.udpStartListener(); err != nil {
+				return err
+			}
+			continue
+		}
+		if n > 0 {
+			s.queueSyslog(buf[:n], addr)
+		}
+	}
+}
+
+// handleSyslogConnection handles syslog over TCP, with octet-counted or newline-terminated frames.
+func (s *Server) handleSyslogConnection(conn net.Conn) {
+	defer conn.Close()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 4096), syslogMaxSize)
+	sc.Split(syslog.ScanFrames)
+	for sc.Scan() {
+		s.queueSyslog(sc.Bytes(), conn.RemoteAddr())
+	}
+	if err := sc.Err(); err != nil && !s.isClosed() {
+		client.Warnf("%v: failed to handle syslog connection from %v: %v", s, conn.RemoteAddr(), err)
+	}
+}
+
+// queueSyslog converts a syslog message from peer into our own format, and queues it for fanout.
+// Messages that can't be parsed are passed on as they are, with type Unknown.
+func (s *Server) queueSyslog(buf []byte, peer net.Addr) {
+	var m *msg.Message
+	if sm, err := syslog.Parse(buf); err == nil {
+		m = sm.Smartlog()
+	} else {
+		m = &msg.Message{
+			Type:    msg.Unknown,
+			Message: string(buf),
+		}
+	}
+	if s.hops {
+		m.Hops = append(m.Hops, s.hop(peer))
+	}
+	for _, b := range msg.BytesFromMessage(m) {
+		s.bufCh <- &inbound{buf: b}
+	}
+}
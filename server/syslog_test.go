@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/client/any"
+)
+
+func TestSyslog(t *testing.T) {
+	dir := t.TempDir()
+	for i, test := range []struct {
+		serverURI string
+		send      string
+		want      []string
+	}{
+		{
+			serverURI: fmt.Sprintf("syslog://127.0.0.1:%v", freePort(t)),
+			send:      "<28>1 2022-01-02T03:04:05Z host app 42 - - disk almost full",
+			want:      []string{"| W | disk almost full | facility=daemon host=host app=app procid=\"42\"\n"},
+		},
+		{
+			serverURI: fmt.Sprintf("syslog+tcp://127.0.0.1:%v", freePort(t)),
+			send:      "14 <14>app: first15 <15>app: second\n<10>third\nnot syslog\n",
+			want: []string{
+				"| I | first | facility=user app=app\n",
+				"| D | second | facility=user app=app\n",
+				"| C | third | facility=user\n",
+				"| ? | not syslog\n",
+			},
+		},
+		{
+			serverURI: "syslog+unix://" + filepath.Join(dir, "log"),
+			send:      "<30>cron[7]: job done",
+			want:      []string{"| I | job done | facility=daemon app=cron procid=\"7\"\n"},
+		},
+	} {
+		s, err := New(test.serverURI)
+		if err != nil {
+			t.Fatalf("New(%q) = _,%v, need nil error", test.serverURI, err)
+		}
+		name := filepath.Join(dir, fmt.Sprintf("out%v.log", i))
+		fileClient, err := any.New("file://" + name)
+		if err != nil {
+			t.Fatalf("any.New(file://%v) = _,%v, need nil error", name, err)
+		}
+		s.AddClient(fileClient)
+		go s.Serve()
+
+		conn, err := net.Dial(s.URI.Scheme.Network(), s.URI.Address())
+		if err != nil {
+			t.Fatalf("%v: Dial() = _,%v, need nil error", test.serverURI, err)
+		}
+		if _, err := conn.Write([]byte(test.send)); err != nil {
+			t.Fatalf("%v: Write() = _,%v, need nil error", test.serverURI, err)
+		}
+		conn.Close()
+
+		var got string
+		for i := 0; i < 50 && strings.Count(got, "\n") < len(test.want); i++ {
+			time.Sleep(time.Second / 100)
+			b, _ := ioutil.ReadFile(name)
+			got = string(b)
+		}
+		for _, w := range test.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%v: server wrote %q, want %q", test.serverURI, got, w)
+			}
+		}
+		s.Close()
+	}
+}
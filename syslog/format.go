@@ -0,0 +1,167 @@
+package syslog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// FieldsID is the SD-ID under which the fields of smartlog messages are sent as structured data.
+// 32473 is the private enterprise number that RFC 5612 reserves for documentation.
+const FieldsID = "smartlog@32473"
+
+// severityForType maps smartlog message types onto syslog severities.
+var severityForType = map[msg.MsgType]int{
+	msg.Trace:    Debug,
+	msg.Debug:    Debug,
+	msg.Info:     Informational,
+	msg.Notice:   Notice,
+	msg.Warn:     Warning,
+	msg.Error:    Error,
+	msg.Critical: Critical,
+	msg.Fatal:    Alert,
+	msg.Unknown:  Notice,
+}
+
+// Header holds what a sender states about itself in RFC 5424 messages.
+type Header struct {
+	Facility int
+	Hostname string
+	AppName  string
+	ProcID   string
+}
+
+// DefaultHeader returns the header for facility user, with the hostname, program name and PID of
+// the running program.
+func DefaultHeader() *Header {
+	host, _ := os.Hostname()
+	return &Header{
+		Facility: 1,
+		Hostname: host,
+		AppName:  filepath.Base(os.Args[0]),
+		ProcID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Format returns m as an RFC 5424 message, without framing. The fields of m are sent as structured
+// data with the SD-ID FieldsID. The origin of m, when it states one, takes precedence over the
+// header h: a server that forwards to syslog keeps the host, program and PID of the sender.
+func Format(m *msg.Message, h *Header) []byte {
+	var b bytes.Buffer
+	b.WriteString("<" + strconv.Itoa(h.Facility*8+severityForType[m.Type]) + ">1 ")
+	ts, err := m.Time()
+	if err != nil {
+		ts = time.Now()
+	}
+	b.WriteString(ts.Format("2006-01-02T15:04:05.000000Z07:00"))
+	host, app, procID := h.Hostname, h.AppName, h.ProcID
+	if o := m.Origin; o != nil {
+		if o.Host != "" {
+			host = o.Host
+		}
+		if o.Program != "" {
+			app = o.Program
+		}
+		if o.PID != 0 {
+			procID = strconv.Itoa(o.PID)
+		}
+	}
+	for _, s := range []string{host, app, procID, ""} {
+		b.WriteString(" " + headerField(s))
+	}
+	b.WriteByte(' ')
+	if len(m.Fields) == 0 {
+		b.WriteByte('-')
+	} else {
+		b.WriteString("[" + FieldsID)
+		for _, f := range m.Fields {
+			b.WriteString(" " + sdName(f.Key) + `="` + sdEscape(msg.ValueString(f.Value)) + `"`)
+		}
+		b.WriteByte(']')
+	}
+	if m.Message != "" {
+		b.WriteString(" " + m.Message)
+	}
+	return b.Bytes()
+}
+
+// headerField returns s as a header field of at most 48 printable characters, or "-" when empty.
+func headerField(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > 48 {
+		s = s[:48]
+	}
+	return s
+}
+
+// sdName returns s as a PARAM-NAME of at most 32 printable characters, without =, space, ] or ".
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "_"
+	}
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdEscape(s string) string {
+	return sdEscaper.Replace(s)
+}
+
+// Writer converts what's written to it, smartlog messages in text or JSON format, into syslog
+// messages.
+type Writer struct {
+	w            io.Writer
+	header       *Header
+	octetCounted bool
+}
+
+// NewWriter returns a writer that sends syslog messages to w. Over TCP, messages must be
+// octet-counted (RFC 6587); datagrams hold one message and need no framing.
+func NewWriter(w io.Writer, h *Header, octetCounted bool) *Writer {
+	return &Writer{
+		w:            w,
+		header:       h,
+		octetCounted: octetCounted,
+	}
+}
+
+func (w *Writer) Write(buf []byte) (int, error) {
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		m, _ := msg.Parse(line) // lenient, unparseable lines are sent as Unknown
+		frame := Format(m, w.header)
+		if w.octetCounted {
+			frame = append([]byte(strconv.Itoa(len(frame))+" "), frame...)
+		}
+		if _, err := w.w.Write(frame); err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
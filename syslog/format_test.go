@@ -0,0 +1,115 @@
+package syslog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+func TestFormat(t *testing.T) {
+	h := &Header{Facility: 3, Hostname: "my host", AppName: "app", ProcID: "42"}
+	for _, test := range []struct {
+		m    *msg.Message
+		want string
+	}{
+		{
+			m: &msg.Message{
+				Type:      msg.Warn,
+				Timestamp: []byte("2022-01-02T03:04:05Z"),
+				Message:   "disk almost full",
+			},
+			want: "<28>1 2022-01-02T03:04:05.000000Z my_host app 42 - - disk almost full",
+		},
+		{
+			m: &msg.Message{
+				Type:      msg.Debug,
+				Timestamp: []byte("2022-01-02T03:04:05Z"),
+				Message:   "query",
+				Fields:    []msg.Field{msg.Int("rows", 3), msg.String("sql", `a "b" ]`), msg.String("a b", "")},
+			},
+			want: `<31>1 2022-01-02T03:04:05.000000Z my_host app 42 - [smartlog@32473 rows="3" sql="a \"b\" \]" a_b=""] query`,
+		},
+		{
+			m: &msg.Message{
+				Type:      msg.Info,
+				Timestamp: []byte("2022-01-02T03:04:05Z"),
+				Message:   "forwarded",
+				Origin:    &msg.Origin{Host: "web1", PID: 7, Program: "nginx"},
+			},
+			want: "<30>1 2022-01-02T03:04:05.000000Z web1 nginx 7 - - forwarded",
+		},
+		{
+			m: &msg.Message{
+				Type:      msg.Unknown,
+				Timestamp: []byte("2022-01-02T03:04:05Z"),
+			},
+			want: "<29>1 2022-01-02T03:04:05.000000Z my_host app 42 - -",
+		},
+	} {
+		if got := string(Format(test.m, h)); got != test.want {
+			t.Errorf("Format(%+v) = %q, want %q", test.m, got, test.want)
+		}
+	}
+}
+
+func TestFormatRoundtrip(t *testing.T) {
+	h := &Header{Facility: 16, Hostname: "host", AppName: "app", ProcID: "1"}
+	for _, typ := range []msg.MsgType{msg.Debug, msg.Info, msg.Notice, msg.Warn, msg.Error, msg.Critical, msg.Fatal} {
+		m := &msg.Message{
+			Type:      typ,
+			Timestamp: []byte("2022-01-02T03:04:05Z"),
+			Message:   "hello world",
+			Fields:    []msg.Field{msg.String("user", "karel"), msg.Int("id", 42)},
+		}
+		got, err := Parse(Format(m, h))
+		if err != nil {
+			t.Fatalf("Parse(Format(%v)) = _,%v, need nil error", typ, err)
+		}
+		if got.Type() != typ {
+			t.Errorf("Parse(Format(%v)).Type() = %v, want %v", typ, got.Type(), typ)
+		}
+		if got.Facility != 16 || got.Hostname != "host" || got.AppName != "app" || got.ProcID != "1" {
+			t.Errorf("Parse(Format(%v)) = %+v, header doesn't match %+v", typ, got, h)
+		}
+		// Values in structured data are strings.
+		wantData := []msg.Field{msg.String("user", "karel"), msg.String("id", "42")}
+		if !reflect.DeepEqual(got.Data, wantData) {
+			t.Errorf("Parse(Format(%v)).Data = %v, want %v", typ, got.Data, wantData)
+		}
+		if got.Message != "hello world" {
+			t.Errorf("Parse(Format(%v)).Message = %q, want %q", typ, got.Message, "hello world")
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	h := &Header{Facility: 1, Hostname: "h", AppName: "a", ProcID: "1"}
+	in := "2022-01-02T03:04:05Z | I | one\n2022-01-02T03:04:05Z | W | two\n"
+	for _, test := range []struct {
+		octetCounted bool
+		want         string
+	}{
+		{
+			octetCounted: false,
+			want: "<14>1 2022-01-02T03:04:05.000000Z h a 1 - - one" +
+				"<12>1 2022-01-02T03:04:05.000000Z h a 1 - - two",
+		},
+		{
+			octetCounted: true,
+			want: "47 <14>1 2022-01-02T03:04:05.000000Z h a 1 - - one" +
+				"47 <12>1 2022-01-02T03:04:05.000000Z h a 1 - - two",
+		},
+	} {
+		var out bytes.Buffer
+		w := NewWriter(&out, h, test.octetCounted)
+		n, err := w.Write([]byte(in))
+		if err != nil || n != len(in) {
+			t.Fatalf("Write() = %v,%v, want %v,nil", n, err, len(in))
+		}
+		if got := out.String(); got != test.want {
+			t.Errorf("octetCounted=%v: wrote %q, want %q", test.octetCounted, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package syslog converts between syslog messages (RFC 5424 and RFC 3164) and smartlog messages.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+// Severities, RFC 5424 section 6.2.1.
+const (
+	Emergency = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+// Facilities by their number, RFC 5424 section 6.2.1.
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// FacilityName returns the name of a facility, e.g. "daemon" for 3.
+func FacilityName(f int) string {
+	if f < 0 || f >= len(facilityNames) {
+		return strconv.Itoa(f)
+	}
+	return facilityNames[f]
+}
+
+// FacilityFromString returns the number of a named facility, e.g. 3 for "daemon".
+func FacilityFromString(s string) (int, error) {
+	for i, name := range facilityNames {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown facility %q", s)
+}
+
+// typeForSeverity maps syslog severities onto smartlog message types.
+var typeForSeverity = map[int]msg.MsgType{
+	Emergency:     msg.Fatal,
+	Alert:         msg.Fatal,
+	Critical:      msg.Critical,
+	Error:         msg.Error,
+	Warning:       msg.Warn,
+	Notice:        msg.Notice,
+	Informational: msg.Info,
+	Debug:         msg.Debug,
+}
+
+// Message is a parsed syslog message. Fields that the message doesn't have are empty.
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time // zero when the message has none
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	Data      []msg.Field // structured data (RFC 5424), keyed SD-ID.PARAM-NAME, or PARAM-NAME for FieldsID
+	Message   string
+}
+
+// Type returns the smartlog message type for the severity of m.
+func (m *Message) Type() msg.MsgType {
+	return typeForSeverity[m.Severity]
+}
+
+// Smartlog returns m as a smartlog message. The syslog header becomes fields facility, host, app,
+// procid and msgid, followed by the structured data. An empty message becomes "-".
+func (m *Message) Smartlog() *msg.Message {
+	out := &msg.Message{
+		Type:    m.Type(),
+		Message: m.Message,
+		Fields:  []msg.Field{msg.String("facility", FacilityName(m.Facility))},
+	}
+	if strings.TrimSpace(out.Message) == "" {
+		out.Message = "-"
+	}
+	if !m.Timestamp.IsZero() {
+		ts := m.Timestamp.Local()
+		if msg.UTCTime {
+			ts = ts.UTC()
+		}
+		out.Timestamp = []byte(ts.Format(msg.DefaultTimeFormat))
+	}
+	for _, f := range []msg.Field{
+		msg.String("host", m.Hostname),
+		msg.String("app", m.AppName),
+		msg.String("procid", m.ProcID),
+		msg.String("msgid", m.MsgID),
+	} {
+		if f.Value != "" {
+			out.Fields = append(out.Fields, f)
+		}
+	}
+	out.Fields = append(out.Fields, m.Data...)
+	return out
+}
+
+// Parse parses an RFC 5424 or RFC 3164 message. RFC 3164 is lenient by nature: when the header
+// isn't recognized, what follows the priority is the message.
+func Parse(buf []byte) (*Message, error) {
+	s := strings.TrimRight(string(buf), "\r\n\x00")
+	if !strings.HasPrefix(s, "<") {
+		return nil, errors.New("syslog message doesn't start with <PRI>")
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, errors.New("syslog message has a malformed <PRI>")
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("syslog message has an invalid priority %q", s[1:end])
+	}
+	m := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+	s = s[end+1:]
+	if strings.HasPrefix(s, "1 ") {
+		return m, m.parse5424(s[2:])
+	}
+	m.parse3164(s)
+	return m, nil
+}
+
+// parse5424 parses TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+func (m *Message) parse5424(s string) error {
+	header := []*string{nil, &m.Hostname, &m.AppName, &m.ProcID, &m.MsgID}
+	for i, dst := range header {
+		sp := strings.IndexByte(s, ' ')
+		if sp < 0 {
+			return errors.New("syslog message has an incomplete RFC 5424 header")
+		}
+		field := s[:sp]
+		s = s[sp+1:]
+		if field == "-" {
+			continue
+		}
+		if i == 0 {
+			ts, err := time.Parse(time.RFC3339Nano, field)
+			if err != nil {
+				return fmt.Errorf("syslog message has an invalid timestamp: %v", err)
+			}
+			m.Timestamp = ts
+			continue
+		}
+		*dst = field
+	}
+
+	var err error
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if s, err = m.parseData(s); err != nil {
+		return err
+	}
+	s = strings.TrimPrefix(s, " ")
+	m.Message = strings.TrimPrefix(s, "\xEF\xBB\xBF") // BOM
+	return nil
+}
+
+// parseData parses the structured data [ID NAME="VALUE" ...][...] and returns what follows.
+func (m *Message) parseData(s string) (string, error) {
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		i := strings.IndexAny(s, " ]")
+		if i < 1 {
+			return "", errors.New("syslog message has malformed structured data")
+		}
+		id := s[:i]
+		s = s[i:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, "=\"")
+			if eq < 1 {
+				return "", fmt.Errorf("syslog message has a malformed parameter in [%v]", id)
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+			var value strings.Builder
+			for {
+				if s == "" {
+					return "", fmt.Errorf("syslog message has an unterminated value in [%v]", id)
+				}
+				c := s[0]
+				s = s[1:]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && s != "" && strings.IndexByte(`"\]`, s[0]) >= 0 {
+					c = s[0]
+					s = s[1:]
+				}
+				value.WriteByte(c)
+			}
+			key := id + "." + name
+			if id == FieldsID {
+				key = name // our own fields, see Format
+			}
+			m.Data = append(m.Data, msg.String(key, value.String()))
+		}
+		if !strings.HasPrefix(s, "]") {
+			return "", fmt.Errorf("syslog message has unterminated structured data [%v]", id)
+		}
+		s = s[1:]
+	}
+	return s, nil
+}
+
+// parse3164 parses [TIMESTAMP HOSTNAME] [TAG[PID]:] MSG.
+func (m *Message) parse3164(s string) {
+	if len(s) >= len(time.Stamp)+1 && s[len(time.Stamp)] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			// RFC 3164 has no year, so take the one that puts the message closest to now.
+			now := time.Now()
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.AddDate(0, 1, 0)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = ts
+			s = s[len(time.Stamp)+1:]
+			if sp := strings.IndexByte(s, ' '); sp > 0 && !isTag(s[:sp]) {
+				m.Hostname = s[:sp]
+				s = s[sp+1:]
+			}
+		}
+	}
+	if sp := strings.IndexByte(s, ' '); sp > 0 && isTag(s[:sp]) {
+		tag := strings.TrimSuffix(s[:sp], ":")
+		if i := strings.IndexByte(tag, '['); i > 0 && strings.HasSuffix(tag, "]") {
+			m.ProcID = tag[i+1 : len(tag)-1]
+			tag = tag[:i]
+		}
+		m.AppName = tag
+		s = s[sp+1:]
+	}
+	m.Message = s
+}
+
+// isTag is true for an RFC 3164 tag such as "sshd:" or "sshd[123]:".
+func isTag(s string) bool {
+	if !strings.HasSuffix(s, ":") || len(s) < 2 {
+		return false
+	}
+	for _, r := range strings.TrimSuffix(s, ":") {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_./[]", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanFrames is a bufio.SplitFunc for syslog over TCP (RFC 6587). Frames are either octet-counted
+// ("LEN MSG"), or terminated by a newline.
+func ScanFrames(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	if data[0] >= '1' && data[0] <= '9' {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			if atEOF {
+				return 0, nil, errors.New("syslog frame has an incomplete length")
+			}
+			return 0, nil, nil
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil {
+			return 0, nil, fmt.Errorf("syslog frame has an invalid length: %v", err)
+		}
+		if len(data) < sp+1+n {
+			if atEOF {
+				return 0, nil, errors.New("syslog frame is truncated")
+			}
+			return 0, nil, nil
+		}
+		return sp + 1 + n, data[sp+1 : sp+1+n], nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,176 @@
+package syslog
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/smartlog/msg"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		buf       string
+		want      *Message
+		wantError string
+	}{
+		{
+			// RFC 5424 example 1
+			buf: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - \xEF\xBB\xBF'su root' failed for lonvick on /dev/pts/8",
+			want: &Message{
+				Facility:  4,
+				Severity:  Critical,
+				Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "su",
+				MsgID:     "ID47",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			// RFC 5424 example 3, with structured data
+			buf: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Appl\"ication"][x@1 y="]"] An application event`,
+			want: &Message{
+				Facility:  20,
+				Severity:  Notice,
+				Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "evntslog",
+				ProcID:    "1234",
+				MsgID:     "ID47",
+				Data: []msg.Field{
+					msg.String("exampleSDID@32473.iut", "3"),
+					msg.String("exampleSDID@32473.eventSource", `Appl"ication`),
+					msg.String("x@1.y", "]"),
+				},
+				Message: "An application event",
+			},
+		},
+		{
+			// RFC 5424 without anything
+			buf: "<7>1 - - - - - -\n",
+			want: &Message{
+				Severity: Debug,
+			},
+		},
+		{
+			// RFC 3164
+			buf: "<13>Feb  5 17:32:18 myhost sshd[4711]: Accepted publickey for karel",
+			want: &Message{
+				Facility:  1,
+				Severity:  Notice,
+				Timestamp: time.Date(0, 2, 5, 17, 32, 18, 0, time.Local), // year is fixed below
+				Hostname:  "myhost",
+				AppName:   "sshd",
+				ProcID:    "4711",
+				Message:   "Accepted publickey for karel",
+			},
+		},
+		{
+			// RFC 3164 without a hostname, as sent to /dev/log
+			buf: "<30>Feb  5 17:32:18 cron: job done",
+			want: &Message{
+				Facility:  3,
+				Severity:  Informational,
+				Timestamp: time.Date(0, 2, 5, 17, 32, 18, 0, time.Local),
+				AppName:   "cron",
+				Message:   "job done",
+			},
+		},
+		{
+			// Just a priority
+			buf: "<11>something broke",
+			want: &Message{
+				Facility: 1,
+				Severity: Error,
+				Message:  "something broke",
+			},
+		},
+		{
+			buf:       "no priority",
+			wantError: "doesn't start with <PRI>",
+		},
+		{
+			buf:       "<192>too high",
+			wantError: "invalid priority",
+		},
+		{
+			buf:       "<1>1 yesterday host app - - - hi",
+			wantError: "invalid timestamp",
+		},
+		{
+			buf:       `<1>1 - host app - - [id x="unterminated`,
+			wantError: "unterminated value",
+		},
+	} {
+		got, err := Parse([]byte(test.buf))
+		switch {
+		case test.wantError != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("Parse(%q) = _,%v, want error with %q", test.buf, err, test.wantError)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Parse(%q) = _,%v, need nil error", test.buf, err)
+			continue
+		}
+		if !test.want.Timestamp.IsZero() && test.want.Timestamp.Year() == 0 {
+			test.want.Timestamp = test.want.Timestamp.AddDate(got.Timestamp.Year(), 0, 0)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.buf, got, test.want)
+		}
+	}
+}
+
+func TestSmartlog(t *testing.T) {
+	m, err := Parse([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 1234 ID47 [x@1 y="z"] hello`))
+	if err != nil {
+		t.Fatalf("Parse(_) = _,%v, need nil error", err)
+	}
+	got := string(msg.BytesFromMessage(m.Smartlog())[0])
+	ts := time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC).Local().Format(msg.DefaultTimeFormat)
+	if want := ts + " | N | hello | facility=local4 host=host app=app procid=\"1234\" msgid=ID47 x@1.y=z\n"; got != want {
+		t.Errorf("Smartlog() gives %q, want %q", got, want)
+	}
+
+	for sev, want := range map[int]msg.MsgType{
+		Emergency: msg.Fatal, Alert: msg.Fatal, Critical: msg.Critical, Error: msg.Error,
+		Warning: msg.Warn, Notice: msg.Notice, Informational: msg.Info, Debug: msg.Debug,
+	} {
+		if got := (&Message{Severity: sev}).Type(); got != want {
+			t.Errorf("severity %v gives type %v, want %v", sev, got, want)
+		}
+	}
+}
+
+func TestScanFrames(t *testing.T) {
+	in := "10 <1>1 - - a11 <1>message\n<2>line framed\n<3>at EOF"
+	sc := bufio.NewScanner(strings.NewReader(in))
+	sc.Split(ScanFrames)
+	got := []string{}
+	for sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Scan() error %v, need nil error", err)
+	}
+	want := []string{"<1>1 - - a", "<1>message\n", "<2>line framed", "<3>at EOF"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanFrames gives %q, want %q", got, want)
+	}
+}
+
+func TestFacility(t *testing.T) {
+	for _, name := range []string{"kern", "daemon", "local7"} {
+		f, err := FacilityFromString(name)
+		if err != nil || FacilityName(f) != name {
+			t.Errorf("FacilityFromString(%q) = %v,%v, roundtrip gives %q", name, f, err, FacilityName(f))
+		}
+	}
+	if _, err := FacilityFromString("nonsense"); err == nil {
+		t.Errorf("FacilityFromString(nonsense) = _,nil, want error")
+	}
+}
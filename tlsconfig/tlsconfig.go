@@ -0,0 +1,134 @@
+// Package tlsconfig builds the TLS configuration of tls:// clients and servers from the
+// parameters of their URI:
+//
+//	cert=PATH            PEM certificate; required for servers, enables mutual auth for clients
+//	key=PATH             PEM private key that belongs to cert
+//	ca=PATH              PEM CA bundle to verify the peer, instead of the system roots
+//	servername=NAME      clients: the name to verify in the server's certificate (default: host)
+//	insecure=true        clients: don't verify the server's certificate (testing only)
+//	verify-client=true   servers: require clients to present a certificate signed by ca, which
+//	                     must be given
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+var (
+	ClientParams = []string{"ca", "cert", "key", "servername", "insecure"} // URI parameters for clients
+	ServerParams = []string{"ca", "cert", "key", "verify-client"}          // URI parameters for servers
+)
+
+// IsClientParam is true when key configures TLS for clients.
+func IsClientParam(key string) bool {
+	return contains(ClientParams, key)
+}
+
+// IsServerParam is true when key configures TLS for servers.
+func IsServerParam(key string) bool {
+	return contains(ServerParams, key)
+}
+
+// ForClient returns the configuration for dialing a tls:// URI.
+func ForClient(ur *uri.URI) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: ur.Parts[0],
+		MinVersion: tls.VersionTLS12,
+	}
+	if name, ok := ur.Params["servername"]; ok {
+		cfg.ServerName = name
+	}
+	cfg.InsecureSkipVerify, _ = strconv.ParseBool(ur.Params["insecure"]) // already checked by uri.New
+
+	var err error
+	if cfg.RootCAs, err = certPool(ur); err != nil {
+		return nil, err
+	}
+	cert, err := keyPair(ur)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return cfg, nil
+}
+
+// ForServer returns the configuration for listening on a tls:// URI.
+func ForServer(ur *uri.URI) (*tls.Config, error) {
+	cert, err := keyPair(ur)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("%v: TLS servers need parameters cert and key", ur)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAs, err = certPool(ur); err != nil {
+		return nil, err
+	}
+	verify, _ := strconv.ParseBool(ur.Params["verify-client"]) // already checked by uri.New
+	if verify && cfg.ClientCAs == nil {
+		// Without ca, any certificate from a public CA would pass.
+		return nil, fmt.Errorf("%v: parameter verify-client needs parameter ca", ur)
+	}
+	switch {
+	case verify:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case cfg.ClientCAs != nil:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// keyPair loads the certificate and key, or returns nil when neither is given.
+func keyPair(ur *uri.URI) (*tls.Certificate, error) {
+	certFile, hasCert := ur.Params["cert"]
+	keyFile, hasKey := ur.Params["key"]
+	if !hasCert && !hasKey {
+		return nil, nil
+	}
+	if !hasCert || !hasKey {
+		return nil, fmt.Errorf("%v: parameters cert and key must be given together", ur)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%v: failed to load certificate: %v", ur, err)
+	}
+	return &cert, nil
+}
+
+// certPool loads the CA bundle, or returns nil (meaning: system roots) when none is given.
+func certPool(ur *uri.URI) (*x509.CertPool, error) {
+	caFile, ok := ur.Params["ca"]
+	if !ok {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("%v: failed to read CA bundle: %v", ur, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%v: no certificates found in CA bundle %v", ur, caFile)
+	}
+	return pool, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/smartlog/tlsconfig/tlstest"
+	"github.com/KarelKubat/smartlog/uri"
+)
+
+func TestForClient(t *testing.T) {
+	f, err := tlstest.Write(t.TempDir())
+	if err != nil {
+		t.Fatalf("tlstest.Write(_) = _,%v, need nil error", err)
+	}
+	for _, test := range []struct {
+		u              string
+		wantServerName string
+		wantCerts      int
+		wantRootCAs    bool
+		wantInsecure   bool
+		wantError      string
+	}{
+		{
+			u:              "tls://localhost:2022",
+			wantServerName: "localhost",
+		},
+		{
+			u:              "tls://127.0.0.1:2022?servername=logs.example.com&insecure=true",
+			wantServerName: "logs.example.com",
+			wantInsecure:   true,
+		},
+		{
+			u:              "tls://localhost:2022?ca=" + f.CA + "&cert=" + f.ClientCert + "&key=" + f.ClientKey,
+			wantServerName: "localhost",
+			wantCerts:      1,
+			wantRootCAs:    true,
+		},
+		{
+			u:         "tls://localhost:2022?cert=" + f.ClientCert,
+			wantError: "cert and key must be given together",
+		},
+		{
+			u:         "tls://localhost:2022?ca=/no/such/file",
+			wantError: "failed to read CA bundle",
+		},
+		{
+			// A key isn't a CA bundle
+			u:         "tls://localhost:2022?ca=" + f.ClientKey,
+			wantError: "no certificates found",
+		},
+	} {
+		ur, err := uri.New(test.u)
+		if err != nil {
+			t.Fatalf("uri.New(%q) = _,%v, need nil error", test.u, err)
+		}
+		cfg, err := ForClient(ur)
+		switch {
+		case err != nil && test.wantError == "":
+			t.Errorf("ForClient(%q) = _,%v, need nil error", test.u, err)
+		case err == nil && test.wantError != "":
+			t.Errorf("ForClient(%q) = _,nil, want error with %q", test.u, test.wantError)
+		case err != nil && !strings.Contains(err.Error(), test.wantError):
+			t.Errorf("ForClient(%q) = _,%v, want error with %q", test.u, err, test.wantError)
+		}
+		if err != nil {
+			continue
+		}
+		if cfg.ServerName != test.wantServerName {
+			t.Errorf("ForClient(%q): ServerName = %q, want %q", test.u, cfg.ServerName, test.wantServerName)
+		}
+		if len(cfg.Certificates) != test.wantCerts {
+			t.Errorf("ForClient(%q): %v certificates, want %v", test.u, len(cfg.Certificates), test.wantCerts)
+		}
+		if (cfg.RootCAs != nil) != test.wantRootCAs {
+			t.Errorf("ForClient(%q): RootCAs = %v, want set: %v", test.u, cfg.RootCAs, test.wantRootCAs)
+		}
+		if cfg.InsecureSkipVerify != test.wantInsecure {
+			t.Errorf("ForClient(%q): InsecureSkipVerify = %v, want %v", test.u, cfg.InsecureSkipVerify, test.wantInsecure)
+		}
+	}
+}
+
+func TestForServer(t *testing.T) {
+	f, err := tlstest.Write(t.TempDir())
+	if err != nil {
+		t.Fatalf("tlstest.Write(_) = _,%v, need nil error", err)
+	}
+	keyPair := "cert=" + f.ServerCert + "&key=" + f.ServerKey
+	for _, test := range []struct {
+		u              string
+		wantClientAuth tls.ClientAuthType
+		wantError      string
+	}{
+		{
+			u:              "tls://:2022?" + keyPair,
+			wantClientAuth: tls.NoClientCert,
+		},
+		{
+			u:              "tls://:2022?" + keyPair + "&ca=" + f.CA,
+			wantClientAuth: tls.VerifyClientCertIfGiven,
+		},
+		{
+			u:              "tls://:2022?" + keyPair + "&ca=" + f.CA + "&verify-client=true",
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{
+			u:         "tls://:2022?" + keyPair + "&verify-client=true",
+			wantError: "verify-client needs parameter ca",
+		},
+		{
+			u:         "tls://:2022",
+			wantError: "need parameters cert and key",
+		},
+		{
+			// Mixed up
+			u:         "tls://:2022?cert=" + f.ServerCert + "&key=" + f.ClientKey,
+			wantError: "failed to load certificate",
+		},
+	} {
+		ur, err := uri.New(test.u)
+		if err != nil {
+			t.Fatalf("uri.New(%q) = _,%v, need nil error", test.u, err)
+		}
+		cfg, err := ForServer(ur)
+		switch {
+		case err != nil && test.wantError == "":
+			t.Errorf("ForServer(%q) = _,%v, need nil error", test.u, err)
+		case err == nil && test.wantError != "":
+			t.Errorf("ForServer(%q) = _,nil, want error with %q", test.u, test.wantError)
+		case err != nil && !strings.Contains(err.Error(), test.wantError):
+			t.Errorf("ForServer(%q) = _,%v, want error with %q", test.u, err, test.wantError)
+		}
+		if err == nil && cfg.ClientAuth != test.wantClientAuth {
+			t.Errorf("ForServer(%q): ClientAuth = %v, want %v", test.u, cfg.ClientAuth, test.wantClientAuth)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package uri
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paramChecks validate the value of a URI parameter.
+type paramChecks map[string]func(string) error
+
+var (
+	// Parameters that all client schemes (except none://) support.
+	formatParam = paramChecks{
+		"format": isOneOf("text", "json"),
+	}
+	// Parameters for clients to state their origin (host, PID, program) in messages.
+	originParams = paramChecks{
+		"origin":  isBool,
+		"service": isNonEmpty,
+	}
+	// Parameters for servers to annotate received messages.
+	hopsParam = paramChecks{
+		"hops": isBool,
+	}
+	// The queue size of servers and of asynchronous clients.
+	bufferParam = paramChecks{
+		"buffer": isCount,
+	}
+	// Parameters for tls:// to configure certificates, see package tlsconfig.
+	tlsParams = paramChecks{
+		"ca":            isNonEmpty,
+		"cert":          isNonEmpty,
+		"key":           isNonEmpty,
+		"servername":    isNonEmpty,
+		"insecure":      isBool,
+		"verify-client": isBool,
+	}
+	// Parameters for network schemes to spool messages while disconnected.
+	spoolParams = paramChecks{
+		"spool":      isNonEmpty,
+		"spool-size": isSize,
+	}
+	// Parameters for stream-oriented network schemes.
+	ackParam = paramChecks{
+		"ack": isBool,
+	}
+	// Parameters for syslog clients, see package client/syslog.
+	syslogParams = paramChecks{
+		"facility": isNonEmpty,
+		"app":      isNonEmpty,
+		"hostname": isNonEmpty,
+		"procid":   isNonEmpty,
+	}
+	// Parameters for http:// to serve the admin API for debug thresholds, see package client/http.
+	adminParams = paramChecks{
+		"admin":       isBool,
+		"admin-token": isNonEmpty,
+	}
+	// Parameters whose values URI.String() doesn't show.
+	secretParams = map[string]bool{
+		"admin-token": true,
+	}
+	// Parameters for file:// to configure rotation.
+	rotationParams = paramChecks{
+		"rotate-size":  isSize,
+		"rotate-every": isPositiveDuration,
+		"keep":         isCount,
+		"compress":     isBool,
+	}
+)
+
+// merge returns the union of parameter checks.
+func merge(checks ...paramChecks) paramChecks {
+	out := paramChecks{}
+	for _, pc := range checks {
+		for key, check := range pc {
+			out[key] = check
+		}
+	}
+	return out
+}
+
+func (pc paramChecks) names() string {
+	names := []string{}
+	for key := range pc {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func parseParams(s, query string, supported paramChecks) (map[string]string, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%v has invalid parameters: %v", s, err)
+	}
+	params := map[string]string{}
+	for key, vals := range values {
+		check, ok := supported[key]
+		if !ok {
+			if len(supported) == 0 {
+				return nil, fmt.Errorf("%v has parameter %q, but this scheme supports no parameters", s, key)
+			}
+			return nil, fmt.Errorf("%v has an unsupported parameter %q, supported: %v", s, key, supported.names())
+		}
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%v has %v values for parameter %q, supported: 1", s, len(vals), key)
+		}
+		if err := check(vals[0]); err != nil {
+			return nil, fmt.Errorf("%v has an invalid value for parameter %q: %v", s, key, err)
+		}
+		params[key] = vals[0]
+	}
+	return params, nil
+}
+
+// ParseSize returns the number of bytes in a size like 512, 10K, 100M or 1G.
+func ParseSize(s string) (int64, error) {
+	mult := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(strings.ToUpper(s), suffix) {
+			mult = m
+			s = s[:len(s)-1]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a valid size", s)
+	}
+	return n * mult, nil
+}
+
+func isSize(s string) error {
+	_, err := ParseSize(s)
+	return err
+}
+
+func isPositiveDuration(s string) error {
+	if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+		return fmt.Errorf("%q must be a positive duration such as 1h", s)
+	}
+	return nil
+}
+
+func isCount(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 1 {
+		return fmt.Errorf("%q must be a number, 1 or more", s)
+	}
+	return nil
+}
+
+func isBool(s string) error {
+	_, err := strconv.ParseBool(s)
+	return err
+}
+
+func isNonEmpty(s string) error {
+	if s == "" {
+		return fmt.Errorf("value may not be empty")
+	}
+	return nil
+}
+
+func isOneOf(valid ...string) func(string) error {
+	return func(s string) error {
+		for _, v := range valid {
+			if s == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must be one of %v", s, strings.Join(valid, ","))
+	}
+}
@@ -2,6 +2,9 @@ package uri
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -15,20 +18,52 @@ const (
 	UDP
 	TCP
 	HTTP
+	Unix       // stream-oriented unix socket, like TCP
+	Unixgram   // datagram-oriented unix socket, like UDP
+	TLS        // TCP with TLS on top
+	Syslog     // syslog over UDP
+	SyslogTCP  // syslog over TCP
+	SyslogUnix // syslog over a datagram-oriented unix socket, like /dev/log
 )
 
 func (u URISchema) String() string {
-	return []string{"none", "file", "udp", "tcp", "http"}[u]
+	return []string{"none", "file", "udp", "tcp", "http", "unix", "unixgram", "tls", "syslog", "syslog+tcp", "syslog+unix"}[u]
+}
+
+// IsNetwork is true for schemes that connect to a smartlog server (or are one), or to a syslog
+// server.
+func (u URISchema) IsNetwork() bool {
+	return u == UDP || u == TCP || u == Unix || u == Unixgram || u == TLS || u.IsSyslog()
+}
+
+// IsSyslog is true for schemes that speak syslog instead of smartlog's own format.
+func (u URISchema) IsSyslog() bool {
+	return u == Syslog || u == SyslogTCP || u == SyslogUnix
+}
+
+// Network returns the name of the network for net.Dial() and net.Listen().
+func (u URISchema) Network() string {
+	switch u {
+	case TLS, SyslogTCP:
+		return TCP.String()
+	case Syslog:
+		return UDP.String()
+	case SyslogUnix:
+		return Unixgram.String()
+	}
+	return u.String()
 }
 
 type URI struct {
 	Scheme URISchema
 	Parts  []string
+	Params map[string]string // from ?key=value&key=value, nil when absent
 }
 
 func New(s string) (*URI, error) {
 	uri := &URI{}
-	// SCHEME://part1:part2:part3:etc, though beyond SCHEME:// we only suport 1 or 2 parts
+	// SCHEME://part1:part2:part3:etc?key=value&key=value, though beyond SCHEME:// we only suport
+	// 1 or 2 parts, and parameters only for some schemes
 	top := strings.Split(s, "://")
 	if len(top) != 2 {
 		return nil, fmt.Errorf("%v: expected: scheme://rest", s)
@@ -37,6 +72,7 @@ func New(s string) (*URI, error) {
 		uriType     URISchema
 		parts       int
 		description string
+		params      paramChecks
 	}{
 		"none": {
 			uriType:     None,
@@ -47,21 +83,61 @@ func New(s string) (*URI, error) {
 			uriType:     File,
 			parts:       1,
 			description: "file://FILENAME",
+			params:      merge(formatParam, bufferParam, rotationParams, originParams),
 		},
 		"udp": {
 			uriType:     UDP,
 			parts:       2,
 			description: "udp://SERVER:PORT",
+			params:      merge(formatParam, bufferParam, spoolParams, originParams, hopsParam),
 		},
 		"tcp": {
 			uriType:     TCP,
 			parts:       2,
 			description: "tcp://SERVER:PORT",
+			params:      merge(formatParam, bufferParam, spoolParams, ackParam, originParams, hopsParam),
 		},
 		"http": {
 			uriType:     HTTP,
 			parts:       2,
 			description: "http://SERVER:PORT",
+			params:      merge(formatParam, bufferParam, originParams, adminParams),
+		},
+		"unix": {
+			uriType:     Unix,
+			parts:       1,
+			description: "unix://SOCKETPATH",
+			params:      merge(formatParam, bufferParam, spoolParams, ackParam, originParams, hopsParam),
+		},
+		"tls": {
+			uriType:     TLS,
+			parts:       2,
+			description: "tls://SERVER:PORT",
+			params:      merge(formatParam, bufferParam, spoolParams, ackParam, tlsParams, originParams, hopsParam),
+		},
+		"syslog": {
+			uriType:     Syslog,
+			parts:       2,
+			description: "syslog://SERVER:PORT",
+			params:      merge(bufferParam, spoolParams, syslogParams, originParams, hopsParam),
+		},
+		"syslog+tcp": {
+			uriType:     SyslogTCP,
+			parts:       2,
+			description: "syslog+tcp://SERVER:PORT",
+			params:      merge(bufferParam, spoolParams, syslogParams, originParams, hopsParam),
+		},
+		"syslog+unix": {
+			uriType:     SyslogUnix,
+			parts:       1,
+			description: "syslog+unix://SOCKETPATH",
+			params:      merge(bufferParam, spoolParams, syslogParams, originParams, hopsParam),
+		},
+		"unixgram": {
+			uriType:     Unixgram,
+			parts:       1,
+			description: "unixgram://SOCKETPATH",
+			params:      merge(formatParam, bufferParam, spoolParams, originParams, hopsParam),
 		},
 	}
 
@@ -78,7 +154,25 @@ func New(s string) (*URI, error) {
 		return nil, fmt.Errorf("%v has an unsupported scheme %q, supported: %v", s, top[0], supported)
 	}
 	uri.Scheme = valid.uriType
-	uri.Parts = strings.Split(top[1], ":")
+	rest := top[1]
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		var err error
+		uri.Params, err = parseParams(s, rest[i+1:], valid.params)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[:i]
+	}
+	if strings.HasPrefix(rest, "[") && valid.parts == 2 {
+		// IPv6 address in brackets, [::1]:PORT
+		host, port, err := net.SplitHostPort(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%v has an invalid address: %v, supported: %v", s, err, valid.description)
+		}
+		uri.Parts = []string{host, port}
+	} else {
+		uri.Parts = strings.Split(rest, ":")
+	}
 	nParts := len(uri.Parts)
 	if nParts > 0 && uri.Parts[nParts-1] == "" {
 		nParts--
@@ -95,6 +189,40 @@ func New(s string) (*URI, error) {
 	return uri, nil
 }
 
+// Address returns what follows SCHEME://, without parameters: a HOSTNAME:PORT for dialing or
+// listening (with an IPv6 address in brackets), or a filename.
+func (u *URI) Address() string {
+	if len(u.Parts) == 2 {
+		return net.JoinHostPort(u.Parts[0], u.Parts[1])
+	}
+	return strings.Join(u.Parts, ":")
+}
+
+// redacted replaces the values of secret parameters in String().
+const redacted = "redacted"
+
+// String returns the URI with its parameters, except that the values of secret parameters such
+// as admin-token are redacted: the string ends up in warnings and web pages.
 func (u *URI) String() string {
-	return fmt.Sprintf("%v://%v", u.Scheme, strings.Join(u.Parts, ":"))
+	s := fmt.Sprintf("%v://%v", u.Scheme, u.Address())
+	if len(u.Params) == 0 {
+		return s
+	}
+	keys := []string{}
+	for key := range u.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		sep := "&"
+		if i == 0 {
+			sep = "?"
+		}
+		val := u.Params[key]
+		if secretParams[key] {
+			val = redacted
+		}
+		s += sep + url.QueryEscape(key) + "=" + url.QueryEscape(val)
+	}
+	return s
 }
@@ -63,6 +63,84 @@ func TestNew(t *testing.T) {
 			u:         "tcp://a:b",
 			wantError: "has an invalid port",
 		},
+
+		// IPv6 needs brackets and a port
+		{
+			u:         "tcp://::1:2022",
+			wantError: "has 4 colon-separated part(s)",
+		},
+		{
+			u:         "tcp://[::1]",
+			wantError: "has an invalid address",
+		},
+		{
+			u:         "tcp://[::1]:port",
+			wantError: "has an invalid port",
+		},
+
+		// Unix sockets need a path
+		{
+			u:         "unix://",
+			wantError: "has 0 colon-separated part(s)",
+		},
+
+		// Parameters
+		{
+			u:         "file:///tmp/x.log?color=blue",
+			wantError: "unsupported parameter \"color\"",
+		},
+		{
+			u:         "file:///tmp/x.log?keep=1&keep=2",
+			wantError: "2 values for parameter \"keep\"",
+		},
+		{
+			u:         "file:///tmp/x.log?keep=%zz",
+			wantError: "invalid parameters",
+		},
+		{
+			u:         "none://x?format=json",
+			wantError: "supports no parameters",
+		},
+		{
+			u:         "tcp://a:1234?keep=1",
+			wantError: "unsupported parameter \"keep\", supported: ack,buffer,format",
+		},
+		{
+			u:         "tcp://a:1234?format=xml",
+			wantError: "invalid value for parameter \"format\"",
+		},
+		{
+			u:         "udp://a:1234?buffer=0",
+			wantError: "invalid value for parameter \"buffer\"",
+		},
+		{
+			u:         "file:///tmp/x.log?rotate-size=big",
+			wantError: "invalid value for parameter \"rotate-size\"",
+		},
+		{
+			u:         "file:///tmp/x.log?rotate-every=often",
+			wantError: "invalid value for parameter \"rotate-every\"",
+		},
+		{
+			u:         "file:///tmp/x.log?rotate-every=-1h",
+			wantError: "invalid value for parameter \"rotate-every\"",
+		},
+		{
+			u:         "file:///tmp/x.log?rotate-every=0s",
+			wantError: "invalid value for parameter \"rotate-every\"",
+		},
+		{
+			u:         "file:///tmp/x.log?spool=/tmp/spool",
+			wantError: "unsupported parameter \"spool\"",
+		},
+		{
+			u:         "tls://a:1234?cert=",
+			wantError: "invalid value for parameter \"cert\"",
+		},
+		{
+			u:         "file:///tmp/x.log?compress=maybe",
+			wantError: "invalid value for parameter \"compress\"",
+		},
 	} {
 		_, err := New(test.u)
 		if err == nil {
@@ -83,6 +161,20 @@ func TestRoundtrip(t *testing.T) {
 		"udp://hostname:1234",
 		"tcp://:1234",
 		"tcp://hostname:1234",
+		"file:///tmp/program.log?keep=3&rotate-size=10M",
+		"file:///tmp/program.log?rotate-every=1h",
+		"file://stdout?format=json",
+		"tcp://hostname:1234?buffer=4096&format=json",
+		"http://:8080?format=text",
+		"tcp://[::1]:2022",
+		"udp://[fe80::1%eth0]:2022",
+		"unix:///tmp/smartlog.sock",
+		"unixgram:///tmp/smartlog.sock?format=json",
+		"tls://hostname:1234?ca=%2Fetc%2Fca.pem&insecure=false",
+		"tcp://hostname:1234?spool=%2Fvar%2Fspool%2Fsmartlog&spool-size=10M",
+		"syslog://:514",
+		"syslog+tcp://hostname:601?buffer=100",
+		"syslog+unix:///dev/log",
 	} {
 		ur, err := New(u)
 		if err != nil {
@@ -92,3 +184,83 @@ func TestRoundtrip(t *testing.T) {
 		}
 	}
 }
+
+func TestRedacted(t *testing.T) {
+	ur, err := New("http://:8080?admin=true&admin-token=s3cret")
+	if err != nil {
+		t.Fatalf("New() = _,%v, need nil error", err)
+	}
+	if got, want := ur.String(), "http://:8080?admin=true&admin-token=redacted"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := ur.Params["admin-token"]; got != "s3cret" {
+		t.Errorf("Params[%q] = %q, want %q", "admin-token", got, "s3cret")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		s         string
+		want      int64
+		wantError bool
+	}{
+		{s: "512", want: 512},
+		{s: "10K", want: 10 << 10},
+		{s: "100m", want: 100 << 20},
+		{s: "1G", want: 1 << 30},
+		{s: "", wantError: true},
+		{s: "-1", wantError: true},
+		{s: "10T", wantError: true},
+	} {
+		got, err := ParseSize(test.s)
+		if gotError := err != nil; gotError != test.wantError || got != test.want {
+			t.Errorf("ParseSize(%q) = %v,%v, want %v, error: %v", test.s, got, err, test.want, test.wantError)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	for _, test := range []struct {
+		u    string
+		want string
+	}{
+		{u: "tcp://:2022", want: ":2022"},
+		{u: "tcp://localhost:2022", want: "localhost:2022"},
+		{u: "tcp://[::1]:2022?format=json", want: "[::1]:2022"},
+		{u: "unix:///tmp/smartlog.sock", want: "/tmp/smartlog.sock"},
+		{u: "tls://localhost:2022?insecure=true", want: "localhost:2022"},
+		{u: "file:///tmp/x.log?keep=2", want: "/tmp/x.log"},
+	} {
+		ur, err := New(test.u)
+		if err != nil {
+			t.Fatalf("New(%q) = _,%v, need nil error", test.u, err)
+		}
+		if got := ur.Address(); got != test.want {
+			t.Errorf("New(%q).Address() = %q, want %q", test.u, got, test.want)
+		}
+		if ur.Scheme.IsNetwork() != (ur.Scheme == TCP || ur.Scheme == Unix || ur.Scheme == TLS) {
+			t.Errorf("New(%q).Scheme.IsNetwork() = %v, want the opposite", test.u, ur.Scheme.IsNetwork())
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	for scheme, want := range map[URISchema]string{
+		TCP:        "tcp",
+		Unixgram:   "unixgram",
+		TLS:        "tcp",
+		Syslog:     "udp",
+		SyslogTCP:  "tcp",
+		SyslogUnix: "unixgram",
+	} {
+		if got := scheme.Network(); got != want {
+			t.Errorf("%v.Network() = %q, want %q", scheme, got, want)
+		}
+		if !scheme.IsNetwork() {
+			t.Errorf("%v.IsNetwork() = false, want true", scheme)
+		}
+		if got := scheme.IsSyslog(); got != strings.HasPrefix(scheme.String(), "syslog") {
+			t.Errorf("%v.IsSyslog() = %v, want the opposite", scheme, got)
+		}
+	}
+}